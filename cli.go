@@ -9,17 +9,26 @@ package cli
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/ucarion/cli/internal/autocompleter"
 	"github.com/ucarion/cli/internal/cmdman"
 	"github.com/ucarion/cli/internal/cmdtree"
 	"github.com/ucarion/cli/internal/exectree"
+	"github.com/ucarion/cli/internal/flagset"
+	"github.com/ucarion/cli/internal/param"
 )
 
 const (
@@ -111,6 +120,14 @@ const (
 //
 //  Foo parentConfigStruct `cli:"bar,subcmd"`
 //
+// A sub-command may also be invoked by other names, listed in the "aliases"
+// tag. Aliases appear in help text and man pages, and are autocompleted unless
+// the "hidealiases" tag is set to "true". An alias may not be the same as the
+// name or alias of one of the sub-command's siblings. For example, this
+// sub-command can be invoked as "remove", "rm", or "del":
+//
+//  Foo parentConfigStruct `cli:"remove,subcmd" aliases:"rm,del"`
+//
 // The option form is indicated by setting "cli" to one of "-x", "--yyy", or
 // "-x,--yyy", where "x" is the "short" name of the option and "yyy" is the
 // "long" name of the option. For example:
@@ -136,6 +153,13 @@ const (
 //  // This is a set of trailing arguments called "files"
 //  Files []string `cli:"files..."`
 //
+// Arguments declared after the trailing arguments take the last values in
+// os.Args, and the trailing arguments take the ones in between. For example,
+// this is how "cp <src>... <dest>" is represented:
+//
+//  Src  []string `cli:"src..." minargs:"1"`
+//  Dest string   `cli:"dest"`
+//
 // Put together, options, arguments, and trailing arguments construct a data
 // model familiar to users of Unix-like tools. For instance, if you have a tool
 // which you can invoke as (where "[...]" means something is optional):
@@ -165,6 +189,32 @@ const (
 // value is set to be the "usage" attribute of the option. The "usage" tag has
 // no use on fields that are not options.
 //
+// Any option may also use the "env" tag. That tag's value is the name of an
+// environment variable the option falls back to if the option is not given in
+// os.Args. For example:
+//
+//  // This option can be set with --token=xxx, or with FOO_TOKEN=xxx.
+//  Token string `cli:"--token" env:"FOO_TOKEN"`
+//
+// The environment variable's value is parsed the same way a value given in
+// os.Args would be, except that bool options accept the values understood by
+// strconv.ParseBool. Empty environment variables are treated as unset. Values
+// from os.Args take precedence over values from the environment; for options
+// that can be passed multiple times, values from os.Args replace, rather than
+// add to, the value from the environment. See the EnvPrefix field of App for a
+// way to give every option an environment variable at once.
+//
+// Any option may also use the "default" tag. That tag's value is parsed, the
+// same way a value in os.Args would be, to produce the option's value if the
+// option is given neither in os.Args nor in its environment variable. For
+// example:
+//
+//  // This option is 30 unless the user says otherwise.
+//  Retries int `cli:"--retries" default:"30"`
+//
+// If the default value cannot be parsed, then Run panics, in the same way it
+// would for any other invalid config struct.
+//
 // Any field that uses the "cli" tag may also use the "value" tag. That tag's
 // value is set to be the "value name" of the option. The "value" tag has no use
 // on fields that are not options that take value.
@@ -202,11 +252,36 @@ const (
 // Then Run will call ExtendedDescription, and the return value will be used as
 // the "extended description" attribute of the command.
 //
+// If a config type satisfies this interface:
+//
+//  interface {
+//      DefaultSubcommand() string
+//  }
+//
+// Then Run will call DefaultSubcommand, and the return value will be used as
+// the name of the command's "default sub-command". The default sub-command is
+// run when the command is invoked without naming one of its sub-commands. A
+// command with a default sub-command cannot itself be one of the elements of
+// funcs.
+//
 // These "usage", "value name", "extended usage", "autocompleter",
 // "description", and "extended description" attributes are later used in the
 // "Command-Line Argument Parsing", "Man Page Generation", and "Bash/Zsh
 // Completions" sections below.
 //
+// If a config type satisfies this interface:
+//
+//  interface {
+//      Validate() error
+//  }
+//
+// Then Run will call Validate once os.Args has been parsed, before calling the
+// command's function. Validate is called on the configs of the command and
+// each of its parents, from the root down, so it can check constraints across
+// several fields. Validate may have a pointer receiver, in which case it may
+// also modify the config. If Validate returns an error, it is treated as a
+// usage error, and is printed along with the command's usage line.
+//
 // By default, all config types are implicitly populated by an additional option
 // whose short name is "h" and whose long name is "help", unless those names are
 // already specified. This additional option is internally marked as being a
@@ -251,6 +326,50 @@ const (
 // using the appropriate method from the strconv package in the standard
 // library.
 //
+// Run also supports these types out of the box:
+//
+//  time.Duration
+//  time.Time
+//  ByteSize
+//  net.IP
+//  netip.Addr
+//  netip.Prefix
+//  HostPort
+//  *url.URL
+//
+// A time.Duration is parsed using time.ParseDuration, as in "30s" or "1h30m".
+//
+// A time.Time is parsed using time.Parse with the RFC 3339 layout, unless the
+// field has a "layout" tag, in which case that layout is used instead. For
+// example:
+//
+//  Since time.Time `cli:"--since" layout:"2006-01-02"`
+//
+// A time.Time can also be given relative to the current time as "now", or
+// "now" followed by a signed duration, as in "now-1h" or "now+30m".
+//
+// A ByteSize is parsed as a number with an optional unit, as in "10MiB" or
+// "1.5GB". See ByteSize for details.
+//
+// A net.IP or netip.Addr is parsed as an IPv4 or IPv6 address, and a
+// netip.Prefix is parsed in CIDR notation, as in "10.0.0.0/8".
+//
+// A HostPort is parsed as "host:port", as in "example.com:443" or "[::1]:8080".
+// If the field has a "defaultport" tag, then the port may be left out, and that
+// port is used instead. For example:
+//
+//  Addr cli.HostPort `cli:"--addr" defaultport:"443"`
+//
+// A *url.URL is parsed using url.Parse, and must have a scheme. If the field
+// has a "schemes" tag, then only the comma-separated schemes it lists are
+// accepted. For example:
+//
+//  Endpoint *url.URL `cli:"--endpoint" schemes:"http,https"`
+//
+// In usage messages and man pages, options of these types are shown as taking
+// a "duration", "time", "size", "ip", "cidr", "host:port", or "url",
+// respectively.
+//
 // Run also works with any type that implements TextUnmarshaler from the
 // encoding standard library package.
 //
@@ -258,6 +377,52 @@ const (
 // implementation, where the text is the value to parse. If TextUnmarshal
 // returns an error, then the text is considered a bad argument.
 //
+// For types you don't own, and so can't add an UnmarshalText method to, you
+// can instead register a parsing function with RegisterParser. For example:
+//
+//  func init() {
+//      cli.RegisterParser(uuid.Parse)
+//  }
+//
+// Registered parsers take precedence over every other way of parsing a type,
+// and are also used for slices, pointers, and maps of the registered type.
+//
+// Run also works with any type that implements Unmarshaler from the
+// encoding/json standard library package, by decoding the text as JSON. Fields
+// of any other type can be decoded as JSON too, by setting their "format" tag
+// to "json". For example:
+//
+//  Filter map[string]string `cli:"--filter" format:"json"`
+//
+// Slices are still given one JSON value at a time, as repeated options or
+// trailing arguments. If a JSON value starts with "@", then the rest of it is
+// the path to a file that holds the JSON instead. In usage messages and man
+// pages, these options are shown as taking "json".
+//
+// Run also works with any type that implements Value from the flag standard
+// library package, by calling Set with the text to parse. If the type has an
+// IsBoolFlag method that returns true, then it's treated like a bool, and is
+// set to "true" when the option is given without a value. See FromFlagSet for
+// using an entire flag.FlagSet as a command.
+//
+// To restrict an option or argument to a fixed set of values, set its "enum"
+// tag to a comma-separated list of those values. For example:
+//
+//  Output string `cli:"--output" enum:"json,yaml,table"`
+//
+// Alternatively, a TextUnmarshaler type can list its allowed values by
+// satisfying this interface:
+//
+//  interface {
+//      Enum() []string
+//  }
+//
+// Run rejects any other value as a bad argument, suggesting the closest allowed
+// value. Unless an "Autocomplete_XXX" method exists, the allowed values are
+// used for autocompletion. Unless a "value" tag exists, the allowed values are
+// shown as the value name in help and man pages, for example
+// "--output <json|yaml|table>".
+//
 // Furthermore, all of the types above are supported in slices or pointers. In
 // other words, if T is one of the types described previously (it is a
 // TextUnmarshaler or is in the list of primitive types above), then []T and *T
@@ -269,10 +434,34 @@ const (
 // be wrapped in a slice; this is because trailing arguments must, by
 // definition, support being passed multiple times.
 //
+// If a slice-typed option has a "sep" tag, then each value passed to the
+// option is split on the tag's value, and each piece becomes a separate
+// element. For instance, with sep:",", then "--tags a,b --tags c" populates
+// three elements. A separator preceded by a backslash is not split on; the
+// backslash is removed, and the separator becomes part of the element.
+//
 // Wrapping a type with a pointer (that is, doing "*T") indicates that the
 // argument may, but does not have to, take a value. See below for more details
 // on how command-line argument parsing works.
 //
+// Maps whose keys are strings, and whose values are one of the types described
+// previously (but not a slice or pointer), are supported as well. Like a slice,
+// a map-typed option can be passed multiple times. Each value is split on its
+// first "=" into a key and a value, so "--label env=prod --label team=infra"
+// populates a map with two entries. By default, a later value for a key
+// replaces an earlier one; if the option's "uniquekeys" tag is set to "true",
+// then a repeated key is a bad argument instead.
+//
+// If a map-typed field named "XXX" has methods named "AutocompleteKey_XXX" and
+// "AutocompleteValue_XXX" on the struct, with the signatures:
+//
+//  func() []string
+//  func(key string) []string
+//
+// Then those methods are used to autocomplete the keys and values of the option,
+// respectively. AutocompleteValue_XXX is called with each of the keys returned
+// by AutocompleteKey_XXX.
+//
 // Command-Line Argument Parsing
 //
 // If the COMP_LINE, COMP_CWORD, and UCARION_CLI_GENERATE_MAN environment
@@ -288,8 +477,9 @@ const (
 // In other words: Run expects the root name of the command in os.Args[0]. It
 // expects that options for a command or subcommand go immediately after the
 // command or subcommand's name. In other words, flags do not "propagate" or get
-// "inherited". For example, if the root-level command takes an option "-x", and
-// a subcommand "y" takes some option "-z", then this is a valid invocation:
+// "inherited", unless they are persistent (see below). For example, if the
+// root-level command takes an option "-x", and a subcommand "y" takes some
+// option "-z", then this is a valid invocation:
 //
 //  cmd -x y -z
 //
@@ -300,22 +490,84 @@ const (
 // Because the options for the root-level command must go before the
 // sub-command's name.
 //
+// Options whose "persistent" tag is set to "true" are the exception. They may
+// also go after the name of any sub-command below the command that declares
+// them, and are still set in that command's config. For example, if "-x" were
+// declared as:
+//
+//  X bool `cli:"-x" persistent:"true"`
+//
+// Then "cmd y -x -z" would be valid, too. Persistent options are listed in the
+// help text of each sub-command below the command that declares them, under
+// "Inherited options". A sub-command may not have an option with the same name
+// as one it inherits.
+//
+// The same goes for arguments. A command with sub-commands may have arguments,
+// but not optional or trailing ones, so that it is always clear which of
+// os.Args is the sub-command's name. For example, if the root-level command
+// has an argument "project" and a sub-command "deploy", then it is invoked as:
+//
+//  cmd my-project deploy
+//
+// Long options and sub-commands must be given by their full names, unless the
+// Abbreviations field of App is true. In that case, they may also be given by
+// any prefix of their names that no other long option or sub-command of the
+// same command starts with, as in "--verb" for "--verbose".
+//
 // Run follows the conventions established by GNU's extensions to the getopt
 // standard from POSIX; these are the conventions familiar to users of most
 // modern Linux distributions. In particular:
 //
-// Options are always optional. Run implements this convention by defaulting all
-// options to their zero value.
+// Options are optional unless they are marked as required. Run implements this
+// convention by defaulting all options to their zero value, or the value of
+// their "default" tag if they have one.
+//
+// To mark an option as required, set its "required" tag to "true". For
+// example:
+//
+//  Project string `cli:"--project" required:"true"`
+//
+// If a required option is given neither in os.Args nor in its environment
+// variable, then Run reports every such missing option in a single usage
+// error. Required options cannot also have a "default" tag.
+//
+// Options can also be constrained together. Options whose "exclusive" tags
+// share a group name cannot be used together. At least one of the options
+// whose "anyof" tags share a group name must be used. An option whose
+// "requires" tag lists other options can only be used alongside them. For
+// example:
+//
+//  JSON  bool   `cli:"--json" exclusive:"output"`
+//  Table bool   `cli:"--table" exclusive:"output"`
+//  Cert  string `cli:"--cert" requires:"--key"`
+//  Key   string `cli:"--key"`
 //
-// Non-trailing arguments are never optional. Trailing arguments are always
-// optional, and default to be a zero-length slice.
+// Run checks these constraints once all of os.Args has been parsed, and
+// reports the first one that isn't met as a usage error. Exclusive groups are
+// shown as "[--json | --table]" in usage messages, and anyof groups as
+// "(--token <token> | --password <password>)".
 //
-// Options whose type is bool cannot take a value. These options can only be set
-// to true, and can only be included by being mentioned by name in os.Args.
-// There are two syntaxes for doing this: the "short" form is for options that
-// have a short name, and the "long" form is for options that have a long name.
-// For example, if the option has short name "f" and long name "force", then
-// these are equivalent:
+// Non-trailing arguments are required, except for pointer-typed arguments that
+// come after every required one, including trailing arguments with a "minargs"
+// tag. Those are optional, and are left nil if they aren't given. Usage
+// messages show optional arguments in square brackets:
+//
+//  // usage: diff [<options>] <a> [<b>]
+//  A string  `cli:"a"`
+//  B *string `cli:"b"`
+//
+// Trailing arguments are optional by default, and default to be a zero-length
+// slice. The "minargs" and "maxargs" tags bound how many values they take:
+//
+//  // usage: kill [<options>] <pid>...
+//  PIDs []int `cli:"pid..." minargs:"1"`
+//
+// Options whose type is bool or *bool do not take a separate value. These
+// options are set to true by being mentioned by name in os.Args. There are two
+// syntaxes for doing this: the "short" form is for options that have a short
+// name, and the "long" form is for options that have a long name. For example,
+// if the option has short name "f" and long name "force", then these are
+// equivalent:
 //
 //  // This is the "short" form
 //  cmd -f
@@ -323,6 +575,36 @@ const (
 //  // This is the "long" form
 //  cmd --force
 //
+// The value of such an option can also be spelled out using the "long stuck"
+// form described below, as in "--force=false". Any value accepted by
+// strconv.ParseBool is allowed.
+//
+// If an option whose type is bool or *bool has a "negatable" tag set to "true",
+// then it also has a negated form, which sets it to false:
+//
+//  Color bool `cli:"--color" negatable:"true"`
+//
+//  // This sets Color to false
+//  cmd --no-color
+//
+// The negated form is shown as "--[no-]color" in help and man pages. See the
+// NegatableBools field of App for a way to make every such option negatable.
+//
+// A *bool option is nil if it isn't given at all, which lets a command tell
+// "not given" apart from "given as false".
+//
+// Options whose type is an integer and whose "counter" tag is set to "true"
+// also do not take a separate value. Instead, they count how many times they
+// are given, including within bundles of short options:
+//
+//  Verbose int `cli:"-v,--verbose" counter:"true"`
+//
+//  // This sets Verbose to 3
+//  cmd -vvv
+//
+// Like a bool option, a counter's value can also be spelled out using the "long
+// stuck" form, as in "--verbose=2".
+//
 // Options whose type is not bool and not a pointer must take a value. There are
 // four syntaxes for setting the value for these options: the two "short" forms
 // are for options that have a short name, and the two "long" forms are for
@@ -342,11 +624,11 @@ const (
 //  // This is the "long detached" form
 //  cmd --output json
 //
-// Options whose type is a pointer may, but do not have to, take a value. To set
-// the value, users must pass the value using either of the "stuck" forms of
-// value-taking options immediately above. To avoid setting an explicit value,
-// users must use either of the forms of the non-value-taking options further
-// above.
+// Options whose type is a pointer (other than *bool) may, but do not have to,
+// take a value. To set the value, users must pass the value using either of the
+// "stuck" forms of value-taking options immediately above. To avoid setting an
+// explicit value, users must use either of the forms of the non-value-taking
+// options further above.
 //
 // If a user sets a value for a pointer-typed option, then the corresponding
 // field will be populated as a pointer to the parsed value. If the user
@@ -365,14 +647,37 @@ const (
 // their arguments, then Run will output the usage message of the appropriate
 // command or sub-command. If the arguments in os.Args ultimately lead to a
 // non-runnable command, then Run will similarly output the usage message of the
-// relevant command.
+// relevant command, unless that command has a default sub-command.
+//
+// If a command has a default sub-command, then any argument that isn't one of
+// the command's options or the name of one of its sub-commands is passed on to
+// the default sub-command, as is the end of os.Args. For instance, if "push" is
+// the default sub-command of "stash", then "stash -p" is the same as "stash
+// push -p", and "stash" is the same as "stash push".
 //
 // The usage message of a given command will contain the name of the command,
 // its extended description, the name of its argument(s), and the names of its
-// options and their usages.
+// options, their usages, and the environment variables they fall back to.
 //
 // If Run calls one of the elements of funcs and that function retuns an error,
-// then the error will be printed to os.Stderr and Run will call os.Exit(1).
+// then the error will be printed to os.Stderr and Run will call os.Exit(1). If
+// the error is or wraps an ExitCoder, then Run will instead call os.Exit with
+// the result of ExitCode. See WithExitCode for a convenient way to construct
+// such errors.
+//
+// If os.Args is not a valid invocation of the command tree (for instance,
+// because it contains an unknown option, is missing a required value, or has
+// an unexpected argument), then Run prints the problem to os.Stderr and calls
+// os.Exit(2), following the Unix convention for usage errors. This lets callers
+// tell apart a bad invocation from a command that ran and failed.
+//
+// By default, Run passes ctx through to the command unchanged. To have Run
+// cancel the context when the process is interrupted, or to add a --timeout
+// option to the tree, use the HandleSignals and TimeoutFlag fields of App.
+//
+// Run is a wrapper around App, which reads from os.Args, os.Environ, and the
+// standard streams of the process. To run a command tree against some other
+// set of arguments, environment variables, or streams, use App instead.
 //
 // Man Page Generation
 //
@@ -386,7 +691,8 @@ const (
 //
 // The man page of a given command will contain the name of the command, its
 // description and extended description, the name of its argument(s), the names
-// of its options and their extended usages.
+// of its options and their extended usages, and the environment variables its
+// options fall back to.
 //
 // If Run encounters an I/O error while generating man pages, it panics.
 //
@@ -419,18 +725,225 @@ const (
 // is expected that for most users, the README will be more useful than these
 // docs, which serve more as a description of the contract that Run upholds.
 func Run(ctx context.Context, funcs ...interface{}) {
+	NewApp().Run(ctx, funcs...)
+}
+
+// NewApp returns an App that gets its arguments, environment, and standard
+// streams from the current process, and that exits the process on failure. This
+// is the App that Run uses.
+//
+// NewApp is a useful starting point if you want Run's behavior plus one of the
+// opt-in features of App, such as HandleSignals.
+func NewApp() App {
+	return App{
+		Args:   os.Args,
+		Env:    os.Environ(),
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		Exit:   os.Exit,
+	}
+}
+
+// App is an environment in which a command tree can be run.
+//
+// Run is a thin wrapper around an App whose fields are populated from the os
+// package. Constructing an App directly is useful when you want to run a
+// command tree without touching the state of the current process, for instance
+// from within a test.
+//
+// Each App is independent of any other App; it is safe to call Run on multiple
+// Apps concurrently.
+type App struct {
+	// Args are the command-line arguments, starting with the name of the
+	// program. This is the App equivalent of os.Args.
+	Args []string
+
+	// Env is the environment, in the same "key=value" form as os.Environ. If
+	// the same key appears multiple times, the last value is used. If Env is
+	// nil, then the App sees an empty environment.
+	Env []string
+
+	// Stdin, Stdout, and Stderr are the standard streams of the App. Commands
+	// can get at them through the Stdin, Stdout, and Stderr functions in this
+	// package. If any of these are nil, then that stream is treated as empty
+	// (for Stdin) or discarded (for Stdout and Stderr).
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Exit, if non-nil, is called with the exit code of the App if that exit
+	// code is non-zero. Run populates Exit with os.Exit.
+	Exit func(int)
+
+	// HandleSignals, if true, makes the App cancel the context passed to
+	// commands when the process receives SIGINT or SIGTERM. If a second such
+	// signal arrives before the command returns, the App stops waiting for the
+	// command and exits immediately with code 130.
+	HandleSignals bool
+
+	// ShutdownGrace, if non-zero, is how long a command has to return after the
+	// first SIGINT or SIGTERM before the App exits with code 130, as though a
+	// second signal had arrived. ShutdownGrace has no effect unless
+	// HandleSignals is true.
+	ShutdownGrace time.Duration
+
+	// TimeoutFlag, if true, adds a --timeout option to every command in the
+	// tree. The option takes a value in the form accepted by
+	// time.ParseDuration, and puts a deadline on the context passed to the
+	// command.
+	TimeoutFlag bool
+
+	// EnvPrefix, if non-empty, makes every option with a long name fall back to
+	// an environment variable, as though it had an "env" tag. The variable's
+	// name is EnvPrefix, an underscore, and then the option's long name in
+	// upper case with dashes replaced by underscores. For instance, if
+	// EnvPrefix is "MYTOOL", then "--dry-run" falls back to "MYTOOL_DRY_RUN".
+	//
+	// Options with an explicit "env" tag are unaffected by EnvPrefix.
+	EnvPrefix string
+
+	// NegatableBools, if true, gives every bool or *bool option with a long name
+	// a negated form, as though it had a "negatable" tag. For instance,
+	// "--color" can then be turned off with "--no-color".
+	NegatableBools bool
+
+	// Abbreviations, if true, lets users abbreviate long options and
+	// sub-command names to any prefix that only one of them starts with. For
+	// instance, "--verb" can then be used for "--verbose", as long as no other
+	// option's name starts with "verb". Ambiguous prefixes are an error that
+	// lists each of the options or sub-commands the prefix could refer to.
+	Abbreviations bool
+}
+
+// ByteSize is a number of bytes, for use as the type of options and arguments.
+//
+// ByteSize accepts a number followed by an optional unit, such as "512",
+// "10MiB", or "1.5GB". The units are B, KB, MB, GB, TB, and PB, which are
+// powers of 1000, and KiB, MiB, GiB, TiB, and PiB, which are powers of 1024.
+// Units are not case-sensitive, and the trailing "B" of a unit may be left out
+// for powers of 1000, as in "10K".
+type ByteSize = param.ByteSize
+
+// HostPort is a network address made of a host and a port, for use as the type
+// of options and arguments.
+//
+// HostPort accepts inputs such as "example.com:443", "[::1]:8080", or ":8080".
+// Its String method formats it the same way.
+type HostPort = param.HostPort
+
+// RegisterParser makes Run support fields of type T, parsing them with parse.
+// It replaces any parser previously registered for T.
+//
+// RegisterParser is meant to be called before Run, typically from an init
+// function.
+func RegisterParser[T any](parse func(string) (T, error)) {
+	RegisterParserWithOptions(parse, ParserOptions{})
+}
+
+// ParserOptions are optional settings for a parser registered with
+// RegisterParserWithOptions.
+type ParserOptions struct {
+	// ValueName, if non-empty, is the name that usage messages and man pages
+	// use for values of the registered type, as in "--id <uuid>". It defaults
+	// to the name of the type.
+	ValueName string
+
+	// Autocomplete, if non-nil, returns the suggestions offered for values of
+	// the registered type. Options and arguments with an autocomplete method
+	// or an enum tag use those suggestions instead.
+	Autocomplete func() []string
+}
+
+// RegisterParserWithOptions is like RegisterParser, but lets opts control how
+// values of type T appear in usage messages and autocompletion.
+func RegisterParserWithOptions[T any](parse func(string) (T, error), opts ParserOptions) {
+	param.Register(reflect.TypeOf((*T)(nil)).Elem(), param.Parser{
+		Parse: func(s string) (reflect.Value, error) {
+			v, err := parse(s)
+			return reflect.ValueOf(&v).Elem(), err
+		},
+		ValueName:    opts.ValueName,
+		Autocomplete: opts.Autocomplete,
+	})
+}
+
+// FromFlagSet returns a command func for fs, for use with Run, so that code
+// written against the standard library's flag package can be moved over to cli
+// one sub-command at a time.
+//
+// The command is a sub-command of the command whose config type is T, and is
+// named after fs. Each of fs's flags becomes an option; flags with one-letter
+// names become short options, such as "-v", and the rest become long options,
+// such as "--verbose". Characters that can't be in option names are replaced
+// with dashes, so a flag named "log.level" becomes "--log-level". If that still
+// doesn't make a valid option name, or two flags become the same option, then
+// Run panics, as it does for other invalid commands. The command takes any
+// number of positional arguments.
+//
+// When the command runs, the values given to its options are passed to fs.Set,
+// in the order they were given, and then fn is called with the parent
+// command's config and the command's positional arguments. Errors from fs.Set
+// are treated as bad arguments.
+func FromFlagSet[T any](fs *flag.FlagSet, fn func(ctx context.Context, parent T, args []string) error) interface{} {
+	return flagset.New(fs, reflect.TypeOf((*T)(nil)).Elem(), func(ctx context.Context, parent reflect.Value, args []string) error {
+		return fn(ctx, parent.Interface().(T), args)
+	})
+}
+
+// ExitCodeInterrupted is the exit code an App uses when it's forced to exit by
+// a signal. It follows the shell convention of 128 plus the number of SIGINT.
+const ExitCodeInterrupted = 130
+
+// Run constructs and executes a command tree from a set of functions, and
+// returns the App's exit code.
+//
+// Run behaves the same as the package-level Run function, except that it
+// gets its arguments, environment, and standard streams from a, and never
+// calls os.Exit. Instead, it returns 0 on success and a non-zero exit code on
+// failure. If a.Exit is non-nil, it is also called with any non-zero exit
+// code.
+func (a App) Run(ctx context.Context, funcs ...interface{}) int {
+	code := a.run(ctx, funcs)
+	if code != 0 && a.Exit != nil {
+		a.Exit(code)
+	}
+
+	return code
+}
+
+func (a App) run(ctx context.Context, funcs []interface{}) int {
+	// Fill in defaults for any of the standard streams that weren't provided.
+	if a.Stdin == nil {
+		a.Stdin = strings.NewReader("")
+	}
+
+	if a.Stdout == nil {
+		a.Stdout = ioutil.Discard
+	}
+
+	if a.Stderr == nil {
+		a.Stderr = ioutil.Discard
+	}
+
 	// If we fail to build a tree from the user's given functions, then we
 	// should panic. Panicking early makes an experience similar to a
 	// compilation error, where the program fails very early and with a message
 	// meant for the program's developer, not its end user.
-	tree, err := cmdtree.New(funcs)
+	tree, err := cmdtree.NewWithOptions(funcs, cmdtree.Options{
+		TimeoutFlag:    a.TimeoutFlag,
+		EnvPrefix:      a.EnvPrefix,
+		NegatableBools: a.NegatableBools,
+		Abbreviations:  a.Abbreviations,
+	})
+
 	if err != nil {
 		panic(err)
 	}
 
 	// Try to see if we are being called as Bash autocompleter.
-	completeLine := os.Getenv(envCompleteLine)
-	completeArgc := os.Getenv(envCompleteArgc)
+	completeLine := a.getenv(envCompleteLine)
+	completeArgc := a.getenv(envCompleteArgc)
 
 	if completeLine != "" && completeArgc != "" {
 		// We are being invoked as a Bash autocompleter.
@@ -440,23 +953,23 @@ func Run(ctx context.Context, funcs ...interface{}) {
 		// an error. The best we can do is be silent.
 		args := strings.Fields(completeLine)
 		argc, err := strconv.Atoi(completeArgc)
-		if err != nil {
-			return
+		if err != nil || argc > len(args) {
+			return 0
 		}
 
 		// With the suggestions in hand, output each of them as a separate line
 		// to stdout.
-		for _, s := range autocompleter.Autocomplete(tree, args[:argc]) {
-			fmt.Println(s)
+		for _, s := range autocompleter.Autocomplete(tree, args[:argc], a.lookupEnv) {
+			fmt.Fprintln(a.Stdout, s)
 		}
 
-		return
+		return 0
 	}
 
 	// Try to see if we are being called by the user for the purposes of
 	// generating the command tree's man pages.
-	if dir := os.Getenv(envGenerateManDir); dir != "" {
-		for name, contents := range cmdman.Man(tree, os.Args[0]) {
+	if dir := a.getenv(envGenerateManDir); dir != "" {
+		for name, contents := range cmdman.Man(tree, a.Args[0]) {
 			filename := filepath.Join(dir, name)
 
 			// Write the file with mode 0666. This is the default with
@@ -476,12 +989,191 @@ func Run(ctx context.Context, funcs ...interface{}) {
 			}
 		}
 
-		return
+		return 0
+	}
+
+	// Make the App's standard streams available to the user's commands.
+	ctx = context.WithValue(ctx, streamsKey{}, streams{
+		stdin:  a.Stdin,
+		stdout: a.Stdout,
+		stderr: a.Stderr,
+	})
+
+	if !a.HandleSignals {
+		// Run the args against the user's command tree.
+		if err := exectree.Exec(ctx, a.Stdout, tree, a.Args, a.lookupEnv); err != nil {
+			fmt.Fprintln(a.Stderr, err.Error())
+			return exitCode(err)
+		}
+
+		return 0
+	}
+
+	// We've been asked to handle signals. Derive a context that we'll cancel on
+	// the first signal, and run the tree in the background so that we can stop
+	// waiting on it if a second signal arrives.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	done := make(chan struct{})
+	defer close(done)
+
+	force := make(chan struct{})
+	go func() {
+		select {
+		case <-sigs:
+			cancel()
+		case <-done:
+			return
+		}
+
+		// A nil channel blocks forever, so if there's no grace period we'll
+		// only be waiting on a second signal.
+		var grace <-chan time.Time
+		if a.ShutdownGrace > 0 {
+			timer := time.NewTimer(a.ShutdownGrace)
+			defer timer.Stop()
+
+			grace = timer.C
+		}
+
+		select {
+		case <-sigs:
+		case <-grace:
+		case <-done:
+			return
+		}
+
+		close(force)
+	}()
+
+	// The buffer lets the goroutine below finish even if we've stopped waiting
+	// on it.
+	errs := make(chan error, 1)
+	go func() {
+		errs <- exectree.Exec(ctx, a.Stdout, tree, a.Args, a.lookupEnv)
+	}()
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			fmt.Fprintln(a.Stderr, err.Error())
+			return exitCode(err)
+		}
+
+		return 0
+	case <-force:
+		return ExitCodeInterrupted
+	}
+}
+
+// ExitCoder is implemented by errors that carry their own exit code.
+//
+// If a command returns an error that is, or wraps, an ExitCoder, then Run
+// exits with the result of ExitCode instead of 1. Errors are unwrapped using
+// errors.As.
+type ExitCoder interface {
+	error
+	ExitCode() int
+}
+
+// WithExitCode wraps err so that Run exits with the given code if a command
+// returns it. The returned error has the same message as err, and unwraps to
+// err.
+//
+// WithExitCode returns nil if err is nil.
+func WithExitCode(err error, code int) error {
+	if err == nil {
+		return nil
 	}
 
-	// Run the args against the user's command tree.
-	if err := exectree.Exec(ctx, tree, os.Args); err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(1)
+	return exitCodeError{err: err, code: code}
+}
+
+type exitCodeError struct {
+	err  error
+	code int
+}
+
+func (e exitCodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e exitCodeError) Unwrap() error {
+	return e.err
+}
+
+func (e exitCodeError) ExitCode() int {
+	return e.code
+}
+
+// exitCode returns the exit code Run should use for err.
+func exitCode(err error) int {
+	var exitCoder ExitCoder
+	if errors.As(err, &exitCoder) {
+		return exitCoder.ExitCode()
 	}
+
+	return 1
+}
+
+// lookupEnv is the App equivalent of os.LookupEnv.
+func (a App) lookupEnv(key string) (string, bool) {
+	// Like os/exec, we let later entries in Env take precedence over earlier
+	// ones.
+	for i := len(a.Env) - 1; i >= 0; i-- {
+		if strings.HasPrefix(a.Env[i], key+"=") {
+			return a.Env[i][len(key)+1:], true
+		}
+	}
+
+	return "", false
+}
+
+// getenv is the App equivalent of os.Getenv.
+func (a App) getenv(key string) string {
+	v, _ := a.lookupEnv(key)
+	return v
+}
+
+type streamsKey struct{}
+
+type streams struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// Stdin returns the standard input of the App running the command that ctx was
+// passed to. If ctx did not come from an App, Stdin returns os.Stdin.
+func Stdin(ctx context.Context) io.Reader {
+	if s, ok := ctx.Value(streamsKey{}).(streams); ok {
+		return s.stdin
+	}
+
+	return os.Stdin
+}
+
+// Stdout returns the standard output of the App running the command that ctx
+// was passed to. If ctx did not come from an App, Stdout returns os.Stdout.
+func Stdout(ctx context.Context) io.Writer {
+	if s, ok := ctx.Value(streamsKey{}).(streams); ok {
+		return s.stdout
+	}
+
+	return os.Stdout
+}
+
+// Stderr returns the standard error of the App running the command that ctx
+// was passed to. If ctx did not come from an App, Stderr returns os.Stderr.
+func Stderr(ctx context.Context) io.Writer {
+	if s, ok := ctx.Value(streamsKey{}).(streams); ok {
+		return s.stderr
+	}
+
+	return os.Stderr
 }
@@ -0,0 +1,303 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/cli"
+)
+
+type appArgs struct {
+	Name string `cli:"--name"`
+}
+
+func TestApp_Run(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	app := cli.App{
+		Args:   []string{"cmd", "--name", "foo"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+
+	code := app.Run(context.Background(), func(ctx context.Context, args appArgs) error {
+		fmt.Fprintln(cli.Stdout(ctx), "hello", args.Name)
+		return nil
+	})
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "hello foo\n", stdout.String())
+	assert.Equal(t, "", stderr.String())
+}
+
+func TestApp_RunError(t *testing.T) {
+	var stderr bytes.Buffer
+	var exitCode int
+	app := cli.App{
+		Args:   []string{"cmd"},
+		Stderr: &stderr,
+		Exit:   func(code int) { exitCode = code },
+	}
+
+	code := app.Run(context.Background(), func(ctx context.Context, args appArgs) error {
+		return errors.New("dummy err")
+	})
+
+	assert.Equal(t, 1, code)
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, "cmd: dummy err\n", stderr.String())
+}
+
+func TestApp_RunHelp(t *testing.T) {
+	var stdout bytes.Buffer
+	app := cli.App{
+		Args:   []string{"cmd", "--help"},
+		Stdout: &stdout,
+	}
+
+	code := app.Run(context.Background(), func(ctx context.Context, args appArgs) error {
+		return nil
+	})
+
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout.String(), "usage: cmd [<options>]")
+}
+
+func TestApp_RunAutocomplete(t *testing.T) {
+	var stdout bytes.Buffer
+	app := cli.App{
+		Args:   []string{"cmd"},
+		Env:    []string{"COMP_LINE=cmd --", "COMP_CWORD=1"},
+		Stdout: &stdout,
+	}
+
+	code := app.Run(context.Background(), func(ctx context.Context, args appArgs) error {
+		t.Fatal("command should not be called when autocompleting")
+		return nil
+	})
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "--name\n", stdout.String())
+}
+
+func TestApp_RunExitCode(t *testing.T) {
+	testCases := []struct {
+		Name string
+		Args []string
+		Err  error
+		Code int
+	}{
+		{
+			Name: "usage error",
+			Args: []string{"cmd", "--bogus"},
+			Code: 2,
+		},
+		{
+			Name: "plain error",
+			Args: []string{"cmd"},
+			Err:  errors.New("dummy err"),
+			Code: 1,
+		},
+		{
+			Name: "exit coder",
+			Args: []string{"cmd"},
+			Err:  cli.WithExitCode(errors.New("dummy err"), 3),
+			Code: 3,
+		},
+		{
+			Name: "wrapped exit coder",
+			Args: []string{"cmd"},
+			Err:  fmt.Errorf("wrapped: %w", cli.WithExitCode(errors.New("dummy err"), 4)),
+			Code: 4,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			app := cli.App{Args: tt.Args}
+			code := app.Run(context.Background(), func(ctx context.Context, args appArgs) error {
+				return tt.Err
+			})
+
+			assert.Equal(t, tt.Code, code)
+		})
+	}
+}
+
+func TestApp_RunHandleSignals(t *testing.T) {
+	app := cli.App{
+		Args:          []string{"cmd"},
+		HandleSignals: true,
+	}
+
+	code := app.Run(context.Background(), func(ctx context.Context, args appArgs) error {
+		p, err := os.FindProcess(os.Getpid())
+		if err != nil {
+			return err
+		}
+
+		if err := p.Signal(os.Interrupt); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(5 * time.Second):
+			return errors.New("context was not cancelled")
+		}
+	})
+
+	assert.Equal(t, 0, code)
+}
+
+func TestApp_RunShutdownGrace(t *testing.T) {
+	var exitCode int
+	app := cli.App{
+		Args:          []string{"cmd"},
+		Exit:          func(code int) { exitCode = code },
+		HandleSignals: true,
+		ShutdownGrace: 10 * time.Millisecond,
+	}
+
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	code := app.Run(context.Background(), func(ctx context.Context, args appArgs) error {
+		p, err := os.FindProcess(os.Getpid())
+		if err != nil {
+			return err
+		}
+
+		if err := p.Signal(os.Interrupt); err != nil {
+			return err
+		}
+
+		// Ignore the cancelled context, so that the grace period expires.
+		<-unblock
+		return nil
+	})
+
+	assert.Equal(t, cli.ExitCodeInterrupted, code)
+	assert.Equal(t, cli.ExitCodeInterrupted, exitCode)
+}
+
+func TestApp_RunTimeoutFlag(t *testing.T) {
+	app := cli.App{
+		Args:        []string{"cmd", "--timeout", "1h"},
+		TimeoutFlag: true,
+	}
+
+	code := app.Run(context.Background(), func(ctx context.Context, args appArgs) error {
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), deadline, time.Minute)
+		return nil
+	})
+
+	assert.Equal(t, 0, code)
+}
+
+type semver struct {
+	Major, Minor, Patch int
+}
+
+func parseSemver(s string) (semver, error) {
+	var v semver
+	if _, err := fmt.Sscanf(s, "%d.%d.%d", &v.Major, &v.Minor, &v.Patch); err != nil {
+		return semver{}, fmt.Errorf("invalid version: %s", s)
+	}
+
+	return v, nil
+}
+
+func TestApp_RunRegisteredParser(t *testing.T) {
+	cli.RegisterParserWithOptions(parseSemver, cli.ParserOptions{ValueName: "version"})
+
+	type args struct {
+		Min     semver   `cli:"--min"`
+		Exclude []semver `cli:"--exclude"`
+		Max     *semver  `cli:"max"`
+	}
+
+	var got args
+	app := cli.App{Args: []string{"cmd", "--min", "1.2.3", "--exclude=1.3.0", "2.0.0"}}
+	code := app.Run(context.Background(), func(ctx context.Context, a args) error {
+		got = a
+		return nil
+	})
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, args{
+		Min:     semver{1, 2, 3},
+		Exclude: []semver{{1, 3, 0}},
+		Max:     &semver{2, 0, 0},
+	}, got)
+
+	var stderr bytes.Buffer
+	app = cli.App{Args: []string{"cmd", "--min", "1.2"}, Stderr: &stderr}
+	code = app.Run(context.Background(), func(ctx context.Context, a args) error {
+		return nil
+	})
+
+	assert.Equal(t, 2, code)
+	assert.Equal(t, "--min: invalid version: 1.2\n", stderr.String())
+
+	var stdout bytes.Buffer
+	app = cli.App{Args: []string{"cmd", "--help"}, Stdout: &stdout}
+	app.Run(context.Background(), func(ctx context.Context, a args) error {
+		return nil
+	})
+
+	assert.True(t, strings.Contains(stdout.String(), "--min <version>"))
+}
+
+func TestApp_RunFromFlagSet(t *testing.T) {
+	type rootArgs struct {
+		Verbose bool `cli:"-v"`
+	}
+
+	fs := flag.NewFlagSet("legacy", flag.ContinueOnError)
+	name := fs.String("name", "", "name to use")
+
+	var gotParent rootArgs
+	var gotArgs []string
+	app := cli.App{Args: []string{"cmd", "-v", "legacy", "--name", "foo", "bar"}}
+	code := app.Run(
+		context.Background(),
+		func(ctx context.Context, a rootArgs) error { return nil },
+		cli.FromFlagSet(fs, func(ctx context.Context, parent rootArgs, args []string) error {
+			gotParent = parent
+			gotArgs = args
+			return nil
+		}),
+	)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, rootArgs{Verbose: true}, gotParent)
+	assert.Equal(t, []string{"bar"}, gotArgs)
+	assert.Equal(t, "foo", *name)
+}
+
+func TestApp_RunByteSize(t *testing.T) {
+	type args struct {
+		Limit cli.ByteSize `cli:"--limit" default:"1KiB"`
+	}
+
+	var got args
+	app := cli.App{Args: []string{"cmd", "--limit", "1.5MB"}}
+	code := app.Run(context.Background(), func(ctx context.Context, a args) error {
+		got = a
+		return nil
+	})
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, cli.ByteSize(1500000), got.Limit)
+}
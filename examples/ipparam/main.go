@@ -4,12 +4,17 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/netip"
+	"net/url"
 
 	"github.com/ucarion/cli"
 )
 
 type args struct {
-	Foo net.IP `cli:"--foo"`
+	Foo      net.IP       `cli:"--foo"`
+	Allow    netip.Prefix `cli:"--allow"`
+	Addr     cli.HostPort `cli:"--addr" defaultport:"443"`
+	Endpoint *url.URL     `cli:"--endpoint" schemes:"http,https"`
 }
 
 func main() {
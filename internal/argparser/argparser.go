@@ -1,9 +1,12 @@
 package argparser
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/ucarion/cli/internal/cmdtree"
 	"github.com/ucarion/cli/internal/command"
@@ -18,18 +21,72 @@ type Parser struct {
 	ShowHelp        bool
 	FlagsTerminated bool
 	PosArgIndex     int
+	TrailingCount   int
 	Flag            command.Flag
 	FlagIsShort     bool
+	Timeout         time.Duration
+
+	// lookupEnv is used to find the values of options that fall back to
+	// environment variables. It may be nil.
+	lookupEnv func(string) (string, bool)
+
+	// implicit is the set of fields in Config whose value came from somewhere
+	// other than args, keyed by fieldKey. Values from args replace, rather than
+	// add to, implicit values.
+	implicit map[string]struct{}
+
+	// used is the set of flags in the current command that were set by args or
+	// the environment, keyed by fieldKey. Unlike implicit, used does not
+	// include flags that merely have a default value.
+	used map[string]struct{}
+
+	// missingRequired is the list of required flags that were not given to
+	// the ancestors of the current command. Those flags can no longer be
+	// given once we've moved on to a sub-command.
+	missingRequired []string
+
+	// envErr is the first invalid value of an environment variable, if any.
+	// It's only reported once args run out, so that --help still works.
+	envErr error
+
+	// flagGroupErr is the first violation of a flag group constraint in the
+	// ancestors of the current command, if any.
+	flagGroupErr error
+
+	// pending are the values given after the command's non-trailing posargs,
+	// when the command has posargs after its trailing ones. Those values can
+	// only be assigned once args run out, because the posargs after the
+	// trailing ones take the last of them.
+	pending []string
+
+	// ancestors are the commands that were descended through to get to the
+	// current command, from the root down. parentIndexes are the indices of
+	// the fields that hold each ancestor's config within its child's config.
+	ancestors     []cmdtree.CommandTree
+	parentIndexes []int
 }
 
-func New(tree cmdtree.CommandTree) Parser {
+func New(tree cmdtree.CommandTree, lookupEnv func(string) (string, bool)) Parser {
 	return Parser{
 		CommandTree: tree,
 		Config:      reflect.New(tree.Config).Elem(),
+		lookupEnv:   lookupEnv,
+		implicit:    map[string]struct{}{},
+		used:        map[string]struct{}{},
 	}
 }
 
 func (p *Parser) ParseArg(s string) error {
+	// If s isn't meant for the current command, but the command has a default
+	// sub-command, then s is meant for the default sub-command instead.
+	if p.Name != nil && !p.ExpectingValue() && p.isForDefaultSubcommand(s) {
+		if err := p.EnterDefaultSubcommand(); err != nil {
+			return err
+		}
+
+		return p.ParseArg(s)
+	}
+
 	switch {
 	case p.Name == nil:
 		// If we don't have a name yet, then we must be parsing argv[0]. So we
@@ -37,10 +94,14 @@ func (p *Parser) ParseArg(s string) error {
 		// our executable.
 		p.Name = []string{s}
 
-	case p.Flag.FieldIndex != nil:
+		// This is also the point at which the root command's config starts
+		// being populated.
+		p.setImplicit()
+
+	case p.ExpectingValue():
 		// We are currently in the state where the next arg is supposed to be
 		// p.Flag's value. The given string is that value.
-		if err := setConfigField(p.Config, p.Flag.FieldIndex, s); err != nil {
+		if err := p.setFlag(p.Flag, s); err != nil {
 			if p.FlagIsShort {
 				return fmt.Errorf("-%s: %w", p.Flag.ShortName, err)
 			}
@@ -70,18 +131,25 @@ func (p *Parser) ParseArg(s string) error {
 		parts := strings.SplitN(s, "=", 2)
 		name, value := parts[0][2:], parts[1]
 
-		flag, err := getLongFlag(p.CommandTree, name)
+		flag, negated, err := getLongFlag(p.CommandTree, name)
 		if err != nil {
 			return err
 		}
 
+		// The negated form of a flag already says what its value is.
+		if negated {
+			return fmt.Errorf("option --%s takes no value", name)
+		}
+
 		// The stuck form is illegal for flags that don't take a value. You
-		// can't do "--foo=bar" if "--foo" doesn't take a value.
-		if !mayTakeValue(p.Config, flag) {
+		// can't do "--foo=bar" if "--foo" doesn't take a value. Boolean and
+		// counter flags are the exception; their value can be spelled out, as
+		// in "--foo=false".
+		if !mayTakeStuckValue(p.Config, flag) {
 			return fmt.Errorf("option --%s takes no value", name)
 		}
 
-		if err := setConfigField(p.Config, flag.FieldIndex, value); err != nil {
+		if err := p.setFlag(flag, value); err != nil {
 			return fmt.Errorf("--%s: %w", name, err)
 		}
 
@@ -89,11 +157,22 @@ func (p *Parser) ParseArg(s string) error {
 		// This is a long flag in the "separate" form, e.g. "--foo bar".
 		//
 		// Here, we strip out the leading dashes in "--foo" into "foo".
-		flag, err := getLongFlag(p.CommandTree, s[2:])
+		//
+		flag, negated, err := getLongFlag(p.CommandTree, s[2:])
 		if err != nil {
 			return err
 		}
 
+		// If this is the negated form of a boolean flag, e.g. "--no-foo",
+		// then we turn the flag off.
+		if negated {
+			if err := p.setFlag(flag, "false"); err != nil {
+				return fmt.Errorf("--%s: %w", s[2:], err)
+			}
+
+			return nil
+		}
+
 		// If the flag doesn't have to take a value, then in the separate
 		// form we just set its value to the empty string. This is the
 		// documented contract for both boolean and optionally-taking-value
@@ -104,7 +183,7 @@ func (p *Parser) ParseArg(s string) error {
 				return nil
 			}
 
-			if err := setConfigField(p.Config, flag.FieldIndex, ""); err != nil {
+			if err := p.setFlag(flag, ""); err != nil {
 				return fmt.Errorf("--%s: %w", s[2:], err)
 			}
 
@@ -128,7 +207,18 @@ func (p *Parser) ParseArg(s string) error {
 			var char string                           // the char we're processing next
 			char, chars = string(chars[0]), chars[1:] // eat a char from chars
 
+			// Each flag in the bundle may be for the default sub-command
+			// rather than the current command. From then on, the rest of the
+			// bundle is for the default sub-command too.
 			flag, err := getShortFlag(p.CommandTree, char)
+			if err != nil && p.isForDefaultSubcommand("-"+char) {
+				if err := p.EnterDefaultSubcommand(); err != nil {
+					return err
+				}
+
+				flag, err = getShortFlag(p.CommandTree, char)
+			}
+
 			if err != nil {
 				return err
 			}
@@ -151,7 +241,7 @@ func (p *Parser) ParseArg(s string) error {
 				// The contract for optionally-taking-value flags is that we set
 				// them to empty-string if the value wasn't provided; that's
 				// precisely what we'll do if chars is empty in this if-block.
-				if err := setConfigField(p.Config, flag.FieldIndex, chars); err != nil {
+				if err := p.setFlag(flag, chars); err != nil {
 					return fmt.Errorf("-%s: %w", char, err)
 				}
 
@@ -162,31 +252,27 @@ func (p *Parser) ParseArg(s string) error {
 				// The flag doesn't take a value. Enable the flag, and keep
 				// scanning the bundle.
 				//
-				// Setting a boolean flag can't fail.
-				setConfigField(p.Config, flag.FieldIndex, "")
+				// Setting a boolean or counter flag this way can't fail.
+				p.setFlag(flag, "")
 			}
 		}
 
 	default:
 		// This argument is not a flag. It's either a positional argument or
 		// a subcommand name. We don't need to worry about ambguity between
-		// these cases; either Children is nonempty, or PosArgs/Trailing are
-		// nonempty, but never both. This is enforced by cmdtree.New.
-		if len(p.CommandTree.Children) != 0 {
+		// these cases; parent commands have a fixed number of posargs, which
+		// come before the subcommand name. This is enforced by cmdtree.New.
+		if p.expectingChild() {
 			// We have children commands, so the arg must be a child command
 			// name.
-			child, ok := p.CommandTree.Children[s]
-			if !ok {
-				dym := didyoumean.DidYouMean(p.CommandTree, s)
-				return fmt.Errorf("unknown sub-command: %s, did you mean: %s?", s, dym)
+			childName, child, err := getChild(p.CommandTree, s)
+			if err != nil {
+				return err
 			}
 
-			childConfig := reflect.New(child.Config).Elem()
-			childConfig.Field(child.ParentIndexInChild).Set(p.Config)
-
-			p.Config = childConfig
-			p.CommandTree = child.CommandTree
-			p.Name = append(p.Name, s)
+			if err := p.enterChild(childName, child); err != nil {
+				return err
+			}
 		} else {
 			// We don't have children commands, so the arg must be a positional
 			// argument.
@@ -199,10 +285,143 @@ func (p *Parser) ParseArg(s string) error {
 	return nil
 }
 
+// expectingChild returns whether the next positional argument is expected to be
+// the name of one of the current command's sub-commands.
+func (p Parser) expectingChild() bool {
+	return len(p.CommandTree.Children) != 0 && p.PosArgIndex == len(p.CommandTree.PosArgs)
+}
+
+// enterChild makes child, whose name is childName, the current command.
+func (p *Parser) enterChild(childName string, child cmdtree.ChildCommand) error {
+	// The current command's posargs can't be given once we've moved on to a
+	// sub-command.
+	if p.PosArgIndex < len(p.CommandTree.PosArgs) {
+		return fmt.Errorf("argument %s requires a value", p.CommandTree.PosArgs[p.PosArgIndex].Name)
+	}
+
+	// Required persistent flags can still be given once we've moved on to a
+	// sub-command, so they're checked at the end instead.
+	var flags []command.Flag
+	for _, f := range p.CommandTree.Flags {
+		if !f.Persistent {
+			flags = append(flags, f)
+		}
+	}
+
+	p.missingRequired = append(p.missingRequired, p.missingRequiredFlags(flags)...)
+
+	// Likewise for flag groups that have persistent flags in them.
+	if p.flagGroupErr == nil {
+		p.flagGroupErr = p.checkFlagGroups(p.CommandTree.Command, func(flags []command.Flag) bool {
+			return !hasPersistent(flags)
+		})
+	}
+
+	// What we know about the flags carries over to the child, keyed by their
+	// index in the child's config. Persistent flags may still be given, and
+	// the rest may be in the same flag groups as them.
+	implicit := map[string]struct{}{}
+	used := map[string]struct{}{}
+	for _, f := range p.CommandTree.AllFlags() {
+		if f.FieldIndex == nil {
+			continue
+		}
+
+		key := fieldKey(f.FieldIndex)
+		childKey := fieldKey(append([]int{child.ParentIndexInChild}, f.FieldIndex...))
+
+		if _, ok := p.implicit[key]; ok {
+			implicit[childKey] = struct{}{}
+		}
+
+		if _, ok := p.used[key]; ok {
+			used[childKey] = struct{}{}
+		}
+	}
+
+	childConfig := reflect.New(child.Config).Elem()
+	childConfig.Field(child.ParentIndexInChild).Set(p.Config)
+
+	p.ancestors = append(p.ancestors, p.CommandTree)
+	p.parentIndexes = append(p.parentIndexes, child.ParentIndexInChild)
+
+	p.Config = childConfig
+	p.CommandTree = child.CommandTree
+	p.Name = append(p.Name, childName)
+	p.PosArgIndex = 0
+	p.implicit = implicit
+	p.used = used
+	p.setImplicit()
+
+	return nil
+}
+
+// EnterDefaultSubcommand makes the default sub-command of the current command,
+// and then the default sub-command of that, and so on, the current command.
+// It does nothing if the current command doesn't have a default sub-command.
+func (p *Parser) EnterDefaultSubcommand() error {
+	for p.CommandTree.DefaultSubcommand != "" {
+		// cmdtree.New will have made sure that the default sub-command exists.
+		childName, child, _ := p.CommandTree.Child(p.CommandTree.DefaultSubcommand)
+		if err := p.enterChild(childName, child); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isForDefaultSubcommand returns whether s, which is not the value of a flag,
+// should be parsed by the default sub-command of the current command. That's
+// the case if the current command has a default sub-command, and s is neither
+// one of the current command's options, nor one of its posargs, nor the name
+// of one of its sub-commands. Ambiguous abbreviations are left for the current
+// command to report.
+//
+// Once a sub-command is expected, the flag terminator and the args after it
+// can't be the name of a sub-command, so they're always for the default
+// sub-command.
+func (p Parser) isForDefaultSubcommand(s string) bool {
+	if p.CommandTree.DefaultSubcommand == "" || s == "-" {
+		return false
+	}
+
+	if p.FlagsTerminated || s == "--" {
+		return p.expectingChild()
+	}
+
+	var err error
+	switch {
+	case strings.HasPrefix(s, "--"):
+		_, _, err = getLongFlag(p.CommandTree, strings.SplitN(s[2:], "=", 2)[0])
+	case strings.HasPrefix(s, "-"):
+		_, err = getShortFlag(p.CommandTree, s[1:2])
+	case p.expectingChild():
+		_, _, err = getChild(p.CommandTree, s)
+	}
+
+	return err != nil && !errors.As(err, &ambiguousError{})
+}
+
 func (p *Parser) parsePosArg(s string) error {
 	var posArg command.PosArg
 	if p.PosArgIndex == len(p.CommandTree.PosArgs) {
 		posArg = p.CommandTree.Trailing
+		p.TrailingCount++
+
+		max := posArg.MaxArgs
+		if max != 0 {
+			max += len(p.CommandTree.AfterTrailing)
+		}
+
+		if max != 0 && p.TrailingCount > max {
+			return fmt.Errorf("argument %s takes at most %d values, got: %s", posArg.Name, posArg.MaxArgs, s)
+		}
+
+		if len(p.CommandTree.AfterTrailing) != 0 {
+			p.pending = append(p.pending, s)
+			return nil
+		}
 	} else {
 		posArg = p.CommandTree.PosArgs[p.PosArgIndex]
 		p.PosArgIndex++
@@ -212,25 +431,176 @@ func (p *Parser) parsePosArg(s string) error {
 		return fmt.Errorf("unexpected argument: %s", s)
 	}
 
-	if err := setConfigField(p.Config, posArg.FieldIndex, s); err != nil {
+	return setPosArg(p.Config, posArg, s)
+}
+
+func setPosArg(config reflect.Value, posArg command.PosArg, s string) error {
+	if err := checkEnum(posArg.Enum, s); err != nil {
 		return fmt.Errorf("%s: %w", posArg.Name, err)
 	}
 
+	if err := setConfigField(config, posArg.FieldIndex, posArg.ParamOptions, s); err != nil {
+		return fmt.Errorf("%s: %w", posArg.Name, err)
+	}
+
+	return nil
+}
+
+// setPending assigns the values in pending to the trailing posargs and the
+// posargs after them.
+func (p Parser) setPending() error {
+	n := len(p.pending) - len(p.CommandTree.AfterTrailing)
+	for i, s := range p.pending {
+		posArg := p.CommandTree.Trailing
+		if i >= n {
+			posArg = p.CommandTree.AfterTrailing[i-n]
+		}
+
+		if err := setPosArg(p.Config, posArg, s); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func getLongFlag(tree cmdtree.CommandTree, s string) (command.Flag, error) {
-	for _, f := range tree.Flags {
+// NextPosArgs returns the posargs that the next positional argument could be
+// assigned to. There can be more than one, because posargs after the trailing
+// ones aren't known to be given until args run out.
+func (p Parser) NextPosArgs() []command.PosArg {
+	if p.PosArgIndex < len(p.CommandTree.PosArgs) {
+		return []command.PosArg{p.CommandTree.PosArgs[p.PosArgIndex]}
+	}
+
+	var out []command.PosArg
+
+	trailing := p.CommandTree.Trailing
+	if trailing.FieldIndex != nil && (trailing.MaxArgs == 0 || p.TrailingCount < trailing.MaxArgs) {
+		out = append(out, trailing)
+	}
+
+	// The next value goes to the i-th posarg after the trailing ones if the
+	// values before it, other than the ones that go to the posargs before
+	// the i-th, are a valid number of trailing values.
+	for i, posArg := range p.CommandTree.AfterTrailing {
+		count := p.TrailingCount - i
+		if count >= trailing.MinArgs && (trailing.MaxArgs == 0 || count <= trailing.MaxArgs) {
+			out = append(out, posArg)
+		}
+	}
+
+	return out
+}
+
+// ambiguousError is returned when an abbreviated long option or sub-command
+// name could refer to more than one of them.
+type ambiguousError struct {
+	Kind       string
+	Name       string
+	Candidates []string
+}
+
+func (e ambiguousError) Error() string {
+	return fmt.Sprintf("ambiguous %s: %s, could be: %s", e.Kind, e.Name, strings.Join(e.Candidates, ", "))
+}
+
+// getChild returns the child command of tree that s, a sub-command name or
+// alias, refers to, as well as the child's name. If tree allows abbreviations,
+// s may also be a prefix of exactly one child's name or aliases.
+func getChild(tree cmdtree.CommandTree, s string) (string, cmdtree.ChildCommand, error) {
+	if name, child, ok := tree.Child(s); ok {
+		return name, child, nil
+	}
+
+	if tree.Abbreviations {
+		var names []string
+		for name, child := range tree.Children {
+			for _, n := range append([]string{name}, child.Aliases...) {
+				if strings.HasPrefix(n, s) {
+					names = append(names, name)
+					break
+				}
+			}
+		}
+
+		sort.Strings(names)
+
+		if len(names) == 1 {
+			return names[0], tree.Children[names[0]], nil
+		}
+
+		if len(names) > 1 {
+			return "", cmdtree.ChildCommand{}, ambiguousError{Kind: "sub-command", Name: s, Candidates: names}
+		}
+	}
+
+	dym := didyoumean.DidYouMean(tree, s)
+	return "", cmdtree.ChildCommand{}, fmt.Errorf("unknown sub-command: %s, did you mean: %s?", s, dym)
+}
+
+// getLongFlag returns the flag that s, the name of a long flag without its
+// leading dashes, refers to. It also returns whether s is the negated form of
+// the flag. If tree allows abbreviations, s may also be a prefix of exactly one
+// flag's long name or negated form.
+func getLongFlag(tree cmdtree.CommandTree, s string) (command.Flag, bool, error) {
+	if f, ok := getNegatedFlag(tree, s); ok {
+		return f, true, nil
+	}
+
+	for _, f := range tree.AllFlags() {
 		if f.LongName == s {
-			return f, nil
+			return f, false, nil
+		}
+	}
+
+	if tree.Abbreviations {
+		var matches []command.Flag
+		var negated []bool
+		var names []string
+		for _, f := range tree.AllFlags() {
+			if f.LongName != "" && strings.HasPrefix(f.LongName, s) {
+				matches = append(matches, f)
+				negated = append(negated, false)
+				names = append(names, "--"+f.LongName)
+			}
+
+			if f.Negatable && strings.HasPrefix(command.NegatedPrefix+f.LongName, s) {
+				matches = append(matches, f)
+				negated = append(negated, true)
+				names = append(names, "--"+command.NegatedPrefix+f.LongName)
+			}
+		}
+
+		if len(matches) == 1 {
+			return matches[0], negated[0], nil
+		}
+
+		if len(matches) > 1 {
+			return command.Flag{}, false, ambiguousError{Kind: "option", Name: "--" + s, Candidates: names}
+		}
+	}
+
+	return command.Flag{}, false, fmt.Errorf("unknown option: --%s", s)
+}
+
+// getNegatedFlag returns the negatable flag that s, the name of a long flag
+// without its leading dashes, is the negated form of.
+func getNegatedFlag(tree cmdtree.CommandTree, s string) (command.Flag, bool) {
+	if !strings.HasPrefix(s, command.NegatedPrefix) {
+		return command.Flag{}, false
+	}
+
+	for _, f := range tree.AllFlags() {
+		if f.Negatable && f.LongName == s[len(command.NegatedPrefix):] {
+			return f, true
 		}
 	}
 
-	return command.Flag{}, fmt.Errorf("unknown option: --%s", s)
+	return command.Flag{}, false
 }
 
 func getShortFlag(tree cmdtree.CommandTree, s string) (command.Flag, error) {
-	for _, f := range tree.Flags {
+	for _, f := range tree.AllFlags() {
 		if f.ShortName == s {
 			return f, nil
 		}
@@ -239,9 +609,162 @@ func getShortFlag(tree cmdtree.CommandTree, s string) (command.Flag, error) {
 	return command.Flag{}, fmt.Errorf("unknown option: -%s", s)
 }
 
-func setConfigField(config reflect.Value, index []int, val string) error {
+// Ancestors returns the commands that were descended through to get to the
+// current command, from the root down.
+func (p Parser) Ancestors() []cmdtree.CommandTree {
+	return p.ancestors
+}
+
+// ExpectingValue returns whether the next arg is expected to be the value of
+// p.Flag.
+func (p Parser) ExpectingValue() bool {
+	return p.Flag.FieldIndex != nil || p.Flag.IsTimeout
+}
+
+func (p *Parser) setFlag(flag command.Flag, val string) error {
+	if flag.IsTimeout {
+		// The special timeout flag isn't backed by a field in the config.
+		// Instead, we keep track of its value in the parser.
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+
+		// A zero Timeout means there's no deadline, so that can't be asked
+		// for explicitly.
+		if d <= 0 {
+			return fmt.Errorf("timeout must be positive, got: %s", val)
+		}
+
+		p.Timeout = d
+		return nil
+	}
+
+	// Optionally-taking-value flags that weren't given a value are exempt from
+	// their enum; they don't have a value to check.
+	if val != "" || mustTakeValue(p.Config, flag) {
+		if err := checkFlagEnum(flag, val); err != nil {
+			return err
+		}
+	}
+
+	// If the flag's current value didn't come from args, then we should
+	// overwrite it, rather than, say, append to it.
+	key := fieldKey(flag.FieldIndex)
+	if _, ok := p.implicit[key]; ok {
+		field := p.Config.FieldByIndex(flag.FieldIndex)
+		field.Set(reflect.Zero(field.Type()))
+		delete(p.implicit, key)
+	}
+
+	p.used[key] = struct{}{}
+
+	return setConfigField(p.Config, flag.FieldIndex, flag.ParamOptions, val)
+}
+
+// setImplicit populates the flags of the current command from their default
+// values and the environment, in that order. Invalid environment variables are
+// recorded in envErr.
+func (p *Parser) setImplicit() {
+	for _, f := range p.CommandTree.Flags {
+		if f.Default == "" {
+			continue
+		}
+
+		// cmdtree.New will have made sure that defaults are valid.
+		setConfigField(p.Config, f.FieldIndex, f.ParamOptions, f.Default)
+		p.implicit[fieldKey(f.FieldIndex)] = struct{}{}
+	}
+
+	if p.lookupEnv == nil {
+		return
+	}
+
+	for _, f := range p.CommandTree.Flags {
+		if f.EnvVar == "" {
+			continue
+		}
+
+		// We treat empty environment variables the same as unset ones.
+		val, _ := p.lookupEnv(f.EnvVar)
+		if val == "" {
+			continue
+		}
+
+		if err := p.setEnv(f, val); err != nil && p.envErr == nil {
+			p.envErr = fmt.Errorf("%s: %w", f.EnvVar, err)
+		}
+	}
+}
+
+// setEnv sets flag to val, the value of its environment variable.
+func (p *Parser) setEnv(flag command.Flag, val string) error {
+	if err := checkFlagEnum(flag, val); err != nil {
+		return err
+	}
+
+	// The environment overrides defaults, rather than adding to them.
+	field := p.Config.FieldByIndex(flag.FieldIndex)
+	field.Set(reflect.Zero(field.Type()))
+
+	if err := setConfigField(p.Config, flag.FieldIndex, flag.ParamOptions, val); err != nil {
+		return err
+	}
+
+	p.implicit[fieldKey(flag.FieldIndex)] = struct{}{}
+	p.used[fieldKey(flag.FieldIndex)] = struct{}{}
+	return nil
+}
+
+// FlagUsed returns whether flag, which must be one of the flags of the current
+// command, was set by args or by the environment.
+func (p Parser) FlagUsed(flag command.Flag) bool {
+	if flag.IsTimeout {
+		return p.Timeout != 0
+	}
+
+	_, ok := p.used[fieldKey(flag.FieldIndex)]
+	return ok
+}
+
+// checkEnum returns an error if enum is non-empty and doesn't contain val.
+func checkEnum(enum []string, val string) error {
+	if len(enum) == 0 {
+		return nil
+	}
+
+	for _, v := range enum {
+		if v == val {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid value: %s, did you mean: %s?", val, didyoumean.Closest(val, enum))
+}
+
+// checkFlagEnum is like checkEnum, except that it checks each of the values in
+// val separately if flag has a separator.
+func checkFlagEnum(flag command.Flag, val string) error {
+	if flag.ParamOptions.Separator == "" {
+		return checkEnum(flag.Enum, val)
+	}
+
+	for _, v := range param.SplitEscaped(val, flag.ParamOptions.Separator) {
+		if err := checkEnum(flag.Enum, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func fieldKey(index []int) string {
+	return fmt.Sprint(index)
+}
+
+func setConfigField(config reflect.Value, index []int, opts param.Options, val string) error {
 	// cmdtree.New will have handled making sure all fields are param-friendly.
-	p, _ := param.New(config.FieldByIndex(index).Addr().Interface())
+	p, _ := param.NewWithOptions(config.FieldByIndex(index).Addr().Interface(), opts)
 	return p.UnmarshalText([]byte(val))
 }
 
@@ -250,7 +773,11 @@ func mayTakeValue(config reflect.Value, flag command.Flag) bool {
 		return false
 	}
 
-	p, _ := param.New(config.FieldByIndex(flag.FieldIndex).Addr().Interface())
+	if flag.IsTimeout {
+		return true
+	}
+
+	p, _ := param.NewWithOptions(config.FieldByIndex(flag.FieldIndex).Addr().Interface(), flag.ParamOptions)
 	return param.MayTakeValue(p)
 }
 
@@ -259,12 +786,36 @@ func mustTakeValue(config reflect.Value, flag command.Flag) bool {
 		return false
 	}
 
-	p, _ := param.New(config.FieldByIndex(flag.FieldIndex).Addr().Interface())
+	if flag.IsTimeout {
+		return true
+	}
+
+	p, _ := param.NewWithOptions(config.FieldByIndex(flag.FieldIndex).Addr().Interface(), flag.ParamOptions)
 	return param.MustTakeValue(p)
 }
 
+// mayTakeStuckValue returns whether flag may be given a value in the long stuck
+// form. This is true of every flag that may take a value, as well as of boolean
+// and counter flags, whose value can be spelled out, as in "--foo=false".
+func mayTakeStuckValue(config reflect.Value, flag command.Flag) bool {
+	if mayTakeValue(config, flag) {
+		return true
+	}
+
+	if flag.IsHelp || flag.IsTimeout {
+		return false
+	}
+
+	p, _ := param.NewWithOptions(config.FieldByIndex(flag.FieldIndex).Addr().Interface(), flag.ParamOptions)
+	return param.IsBool(p) || param.IsCounter(p)
+}
+
 func (p Parser) NoMoreArgs() error {
-	if p.Flag.FieldIndex != nil {
+	if p.envErr != nil {
+		return p.envErr
+	}
+
+	if p.ExpectingValue() {
 		if p.FlagIsShort {
 			return fmt.Errorf("option -%s requires a value", p.Flag.ShortName)
 		} else {
@@ -274,8 +825,184 @@ func (p Parser) NoMoreArgs() error {
 
 	if p.PosArgIndex < len(p.CommandTree.PosArgs) {
 		posArg := p.CommandTree.PosArgs[p.PosArgIndex]
-		return fmt.Errorf("argument %s requires a value", posArg.Name)
+		if !posArg.Optional {
+			return fmt.Errorf("argument %s requires a value", posArg.Name)
+		}
+	}
+
+	// Values for the posargs after the trailing ones come out of the trailing
+	// ones' count.
+	trailing, after := p.CommandTree.Trailing, p.CommandTree.AfterTrailing
+	if count := p.TrailingCount - len(after); trailing.MinArgs != 0 && count < trailing.MinArgs {
+		if trailing.MinArgs == 1 {
+			return fmt.Errorf("argument %s requires a value", trailing.Name)
+		}
+
+		return fmt.Errorf("argument %s requires at least %d values", trailing.Name, trailing.MinArgs)
+	}
+
+	// The posargs after the trailing ones take the last values, so if there
+	// are too few values, then it's the first of those posargs that's missing.
+	if p.TrailingCount < len(after) {
+		return fmt.Errorf("argument %s requires a value", after[0].Name)
+	}
+
+	if err := p.setPending(); err != nil {
+		return err
+	}
+
+	// Report all of the missing required flags at once, so that users don't
+	// have to discover them one at a time.
+	missing := append(p.missingRequired, p.missingRequiredFlags(p.CommandTree.AllFlags())...)
+	if len(missing) == 1 {
+		return fmt.Errorf("missing required option: %s", missing[0])
+	}
+
+	if len(missing) > 1 {
+		return fmt.Errorf("missing required options: %s", strings.Join(missing, ", "))
+	}
+
+	if p.flagGroupErr != nil {
+		return p.flagGroupErr
+	}
+
+	// The ancestors' flag groups that have persistent flags in them were put
+	// off until now, since those flags could be given to any of their
+	// descendants.
+	for i := range p.ancestors {
+		if err := p.checkFlagGroups(p.ancestorCommand(i), hasPersistent); err != nil {
+			return err
+		}
+	}
+
+	return p.checkFlagGroups(p.CommandTree.Command, func(_ []command.Flag) bool {
+		return true
+	})
+}
+
+// ancestorCommand returns the i-th of the ancestors, with the FieldIndex of its
+// flags made relative to the current command's config.
+func (p Parser) ancestorCommand(i int) command.Command {
+	var prefix []int
+	for j := len(p.parentIndexes) - 1; j >= i; j-- {
+		prefix = append(prefix, p.parentIndexes[j])
+	}
+
+	cmd := p.ancestors[i].Command
+	cmd.Flags = nil
+	for _, f := range p.ancestors[i].Flags {
+		if f.FieldIndex != nil {
+			f.FieldIndex = append(append([]int{}, prefix...), f.FieldIndex...)
+		}
+
+		cmd.Flags = append(cmd.Flags, f)
+	}
+
+	return cmd
+}
+
+// hasPersistent returns whether any of flags is persistent.
+func hasPersistent(flags []command.Flag) bool {
+	for _, f := range flags {
+		if f.Persistent {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate calls the Validate methods, if any, of the configs of the current
+// command and its ancestors, from the root down. It returns the first error
+// that any of them return.
+func (p Parser) Validate() error {
+	// The ancestors' configs are the ones embedded in their children's configs,
+	// since those are the ones the command func will receive.
+	configs := []reflect.Value{p.Config}
+	for i := len(p.parentIndexes) - 1; i >= 0; i-- {
+		configs = append([]reflect.Value{configs[0].Field(p.parentIndexes[i])}, configs...)
+	}
+
+	trees := append(p.ancestors[:len(p.ancestors):len(p.ancestors)], p.CommandTree)
+	for i, tree := range trees {
+		if !tree.ValidateFunc.IsValid() {
+			continue
+		}
+
+		out := tree.ValidateFunc.Call([]reflect.Value{configs[i].Addr()})
+		if err := out[0].Interface(); err != nil {
+			return err.(error)
+		}
+	}
+
+	return nil
+}
+
+// checkFlagGroups returns an error if the flags used in cmd, which is the
+// current command or one of its ancestors, violate any of its exclusive,
+// requires, or anyof constraints. Only the constraints whose flags satisfy
+// include are checked.
+func (p Parser) checkFlagGroups(cmd command.Command, include func([]command.Flag) bool) error {
+	for _, g := range cmd.ExclusiveGroups() {
+		if !include(g.Flags) {
+			continue
+		}
+
+		var used []string
+		for _, f := range g.Flags {
+			if p.FlagUsed(f) {
+				used = append(used, f.DisplayName())
+			}
+		}
+
+		if len(used) > 1 {
+			return fmt.Errorf("options cannot be used together: %s", strings.Join(used, ", "))
+		}
+	}
+
+	for _, f := range cmd.Flags {
+		if !p.FlagUsed(f) {
+			continue
+		}
+
+		for _, name := range f.Requires {
+			for _, other := range cmd.Flags {
+				if other.DisplayName() == name && include([]command.Flag{f, other}) && !p.FlagUsed(other) {
+					return fmt.Errorf("option %s requires %s", f.DisplayName(), name)
+				}
+			}
+		}
+	}
+
+	for _, g := range cmd.AnyOfGroups() {
+		if !include(g.Flags) {
+			continue
+		}
+
+		var names []string
+		used := false
+		for _, f := range g.Flags {
+			names = append(names, f.DisplayName())
+			used = used || p.FlagUsed(f)
+		}
+
+		if !used {
+			return fmt.Errorf("at least one of these options is required: %s", strings.Join(names, ", "))
+		}
 	}
 
 	return nil
 }
+
+// missingRequiredFlags returns the names of the required flags among flags,
+// which are flags of the current command, that haven't been used.
+func (p Parser) missingRequiredFlags(flags []command.Flag) []string {
+	var out []string
+	for _, f := range flags {
+		if f.Required && !p.FlagUsed(f) {
+			out = append(out, f.DisplayName())
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,78 @@
+package argparser_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/cli/internal/argparser"
+	"github.com/ucarion/cli/internal/cmdtree"
+)
+
+func parse(t *testing.T, tree cmdtree.CommandTree, args []string) error {
+	parser := argparser.New(tree, nil)
+	for _, arg := range args {
+		if err := parser.ParseArg(arg); err != nil {
+			return err
+		}
+	}
+
+	return parser.NoMoreArgs()
+}
+
+func TestNoMoreArgs_PersistentFlagGroups(t *testing.T) {
+	type anyOfArgs struct {
+		JSON  bool `cli:"--json" anyof:"fmt" persistent:"true"`
+		Table bool `cli:"--table" anyof:"fmt"`
+	}
+
+	type anyOfSubArgs struct {
+		Root anyOfArgs `cli:"sub,subcmd"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ anyOfSubArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, parse(t, tree, []string{"cmd", "sub", "--json"}))
+	assert.NoError(t, parse(t, tree, []string{"cmd", "--table", "sub"}))
+	assert.EqualError(t, parse(t, tree, []string{"cmd", "sub"}),
+		"at least one of these options is required: --json, --table")
+
+	type exclusiveArgs struct {
+		JSON  bool `cli:"--json" exclusive:"fmt" persistent:"true"`
+		Table bool `cli:"--table" exclusive:"fmt"`
+	}
+
+	type exclusiveSubArgs struct {
+		Root exclusiveArgs `cli:"sub,subcmd"`
+	}
+
+	tree, err = cmdtree.New([]interface{}{
+		func(_ context.Context, _ exclusiveSubArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, parse(t, tree, []string{"cmd", "sub", "--json"}))
+	assert.EqualError(t, parse(t, tree, []string{"cmd", "--table", "sub", "--json"}),
+		"options cannot be used together: --json, --table")
+
+	type requiresArgs struct {
+		Cert string `cli:"--cert" requires:"--key"`
+		Key  string `cli:"--key" persistent:"true"`
+	}
+
+	type requiresSubArgs struct {
+		Root requiresArgs `cli:"sub,subcmd"`
+	}
+
+	tree, err = cmdtree.New([]interface{}{
+		func(_ context.Context, _ requiresSubArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, parse(t, tree, []string{"cmd", "--cert=a", "sub", "--key=b"}))
+	assert.EqualError(t, parse(t, tree, []string{"cmd", "--cert=a", "sub"}),
+		"option --cert requires --key")
+}
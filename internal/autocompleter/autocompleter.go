@@ -7,10 +7,13 @@ import (
 	"github.com/ucarion/cli/internal/argparser"
 	"github.com/ucarion/cli/internal/cmdtree"
 	"github.com/ucarion/cli/internal/command"
+	"github.com/ucarion/cli/internal/param"
 )
 
-func Autocomplete(tree cmdtree.CommandTree, args []string) []string {
-	parser := argparser.New(tree)
+func Autocomplete(tree cmdtree.CommandTree, args []string, lookupEnv func(string) (string, bool)) []string {
+	// Options set by the environment count as having been used, so we parse
+	// with the environment just like we would when executing.
+	parser := argparser.New(tree, lookupEnv)
 
 	for _, arg := range args {
 		if err := parser.ParseArg(arg); err != nil {
@@ -20,71 +23,129 @@ func Autocomplete(tree cmdtree.CommandTree, args []string) []string {
 		}
 	}
 
-	if parser.Flag.FieldIndex != nil {
+	if parser.ExpectingValue() {
 		// We are expecting a flag's value next. If that flag has an
-		// autocomplete func, we'll return that func's results. Otherwise, we
-		// have no suggestions.
+		// autocomplete func, we'll return that func's results. Otherwise, we'll
+		// suggest the flag's enum values, if it has any, or else whatever the
+		// parser registered for the flag's type suggests.
 		if !parser.Flag.AutocompleteFunc.IsValid() {
-			return nil
+			if parser.Flag.AutocompleteKeyFunc.IsValid() {
+				return autocompleteMap(parser)
+			}
+
+			if len(parser.Flag.Enum) == 0 && parser.Flag.FieldIndex != nil {
+				out, _ := param.Autocomplete(parser.Config.FieldByIndex(parser.Flag.FieldIndex).Type())
+				return out
+			}
+
+			return parser.Flag.Enum
 		}
 
-		out := parser.Flag.AutocompleteFunc.Call([]reflect.Value{parser.Config})
+		out := parser.Flag.AutocompleteFunc.Call([]reflect.Value{flagConfig(parser)})
 		return out[0].Interface().([]string)
 	}
 
 	var out []string
 
+	// Required flags that haven't been used yet are the most useful
+	// suggestions, so they're kept apart from the rest and go first.
+	var required []string
+
 	// As long as flags aren't terminated, then the next argument could be a
-	// flag.
+	// flag, including one inherited from an ancestor.
 	if !parser.FlagsTerminated {
-		for _, f := range parser.CommandTree.Flags {
+		for _, f := range parser.CommandTree.AllFlags() {
 			// Don't include help flags.
 			if f.IsHelp {
 				continue
 			}
 
-			// If the config value for this flag is non-zero, then we assume
-			// that flag has been used, and so we do not include it in the
-			// autocompletion suggestions.
-			if !parser.Config.FieldByIndex(f.FieldIndex).IsZero() {
+			// If this flag has already been used, then we do not include it in
+			// the autocompletion suggestions. Counters are the exception, since
+			// using them again is the whole point.
+			if parser.FlagUsed(f) && !f.ParamOptions.Counter {
 				continue
 			}
 
-			if f.LongName != "" {
-				out = append(out, "--"+f.LongName)
+			if f.Required {
+				required = append(required, f.DisplayName())
 			} else {
-				out = append(out, "-"+f.ShortName)
+				out = append(out, f.DisplayName())
+			}
+
+			if f.Negatable {
+				out = append(out, "--"+command.NegatedPrefix+f.LongName)
 			}
 		}
 	}
 
-	// If the flag has children commands, then suggest those children command
-	// names.
-	if parser.CommandTree.Children != nil {
-		for childCmd := range parser.CommandTree.Children {
+	// If the command has children commands, and its posargs have all been
+	// given, then suggest those children command names, and their aliases
+	// unless they're hidden.
+	if parser.CommandTree.Children != nil && parser.PosArgIndex == len(parser.CommandTree.PosArgs) {
+		for childCmd, child := range parser.CommandTree.Children {
 			out = append(out, childCmd)
-		}
 
-		// The rest of the possible suggestions are for posargs, which we cannot
-		// have because we instead have child commands.
-		sort.Strings(out)
-		return out
-	}
+			if !child.HideAliases {
+				out = append(out, child.Aliases...)
+			}
+		}
 
-	var posArg command.PosArg
-	if parser.PosArgIndex == len(parser.CommandTree.PosArgs) {
-		posArg = parser.CommandTree.Trailing
-	} else if parser.CommandTree.PosArgs != nil {
-		posArg = parser.CommandTree.PosArgs[parser.PosArgIndex]
+		// The rest of the possible suggestions are for posargs, which have
+		// already been given.
+		return sortSuggestions(required, out)
 	}
 
-	if posArg.FieldIndex != nil {
+	// The next arg may be one of several posargs, if the command has posargs
+	// after its trailing ones. In that case, we suggest values for all of
+	// them.
+	for _, posArg := range parser.NextPosArgs() {
 		if posArg.AutocompleteFunc.IsValid() {
 			fnOut := posArg.AutocompleteFunc.Call([]reflect.Value{parser.Config})
 			out = append(out, fnOut[0].Interface().([]string)...)
+		} else if len(posArg.Enum) != 0 {
+			out = append(out, posArg.Enum...)
+		} else {
+			values, _ := param.Autocomplete(parser.Config.FieldByIndex(posArg.FieldIndex).Type())
+			out = append(out, values...)
+		}
+	}
+
+	return sortSuggestions(required, out)
+}
+
+// autocompleteMap returns suggestions for the value of a map-typed flag, in the
+// form "key=value". If the flag can't complete values, then the suggestions are
+// just "key=".
+func autocompleteMap(parser argparser.Parser) []string {
+	out := []string{}
+
+	config := flagConfig(parser)
+	keys := parser.Flag.AutocompleteKeyFunc.Call([]reflect.Value{config})
+	for _, key := range keys[0].Interface().([]string) {
+		if !parser.Flag.AutocompleteValueFunc.IsValid() {
+			out = append(out, key+"=")
+			continue
+		}
+
+		values := parser.Flag.AutocompleteValueFunc.Call([]reflect.Value{config, reflect.ValueOf(key)})
+		for _, value := range values[0].Interface().([]string) {
+			out = append(out, key+"="+value)
 		}
 	}
 
-	sort.Strings(out)
 	return out
 }
+
+// flagConfig returns the config that parser.Flag's autocomplete funcs take. For
+// flags inherited from ancestors, that's the ancestor's config.
+func flagConfig(parser argparser.Parser) reflect.Value {
+	return parser.Config.FieldByIndex(parser.Flag.ConfigIndex)
+}
+
+// sortSuggestions sorts required and rest, and returns them in that order.
+func sortSuggestions(required, rest []string) []string {
+	sort.Strings(required)
+	sort.Strings(rest)
+	return append(required, rest...)
+}
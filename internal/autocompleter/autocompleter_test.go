@@ -2,11 +2,13 @@ package autocompleter_test
 
 import (
 	"context"
+	"reflect"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/ucarion/cli/internal/autocompleter"
 	"github.com/ucarion/cli/internal/cmdtree"
+	"github.com/ucarion/cli/internal/param"
 )
 
 func TestAutocomplete_Basic(t *testing.T) {
@@ -17,7 +19,7 @@ func TestAutocomplete_Basic(t *testing.T) {
 	})
 
 	assert.NoError(t, err)
-	assert.Equal(t, []string(nil), autocompleter.Autocomplete(tree, nil))
+	assert.Equal(t, []string(nil), autocompleter.Autocomplete(tree, nil, nil))
 }
 
 func TestAutocomplete_Flags(t *testing.T) {
@@ -34,10 +36,10 @@ func TestAutocomplete_Flags(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t,
 		[]string{"--bravo", "--charlie", "-a"},
-		autocompleter.Autocomplete(tree, nil))
+		autocompleter.Autocomplete(tree, nil, nil))
 
 	// This is an invalid invocation. You can't set C (an int) to "xxx".
-	assert.Equal(t, []string(nil), autocompleter.Autocomplete(tree, []string{"cmd", "-cxxx"}))
+	assert.Equal(t, []string(nil), autocompleter.Autocomplete(tree, []string{"cmd", "-cxxx"}, nil))
 }
 
 type autocompleteArgs struct {
@@ -68,10 +70,10 @@ func TestAutocomplete_FlagAutocomplete(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t,
 		[]string{"xxx"},
-		autocompleter.Autocomplete(tree, []string{"cmd", "-axxx", "-b"}))
+		autocompleter.Autocomplete(tree, []string{"cmd", "-axxx", "-b"}, nil))
 	assert.Equal(t,
 		[]string(nil),
-		autocompleter.Autocomplete(tree, []string{"cmd", "-a"}))
+		autocompleter.Autocomplete(tree, []string{"cmd", "-a"}, nil))
 }
 
 func TestAutocomplete_PosArgAutocomplete(t *testing.T) {
@@ -82,7 +84,7 @@ func TestAutocomplete_PosArgAutocomplete(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t,
 		[]string{"-b", "xxx"},
-		autocompleter.Autocomplete(tree, []string{"cmd", "-axxx"}))
+		autocompleter.Autocomplete(tree, []string{"cmd", "-axxx"}, nil))
 }
 
 func TestAutocomplete_TrailingAutocomplete(t *testing.T) {
@@ -93,7 +95,7 @@ func TestAutocomplete_TrailingAutocomplete(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t,
 		[]string{"-a", "-b", "xxx", "yyy"},
-		autocompleter.Autocomplete(tree, []string{"cmd", "a", "b"}))
+		autocompleter.Autocomplete(tree, []string{"cmd", "a", "b"}, nil))
 }
 
 type rootArgs struct {
@@ -120,6 +122,41 @@ func (_ sub2Args) Autocomplete_B() []string {
 	return []string{"yyy"}
 }
 
+type mapArgs struct {
+	Labels  map[string]string `cli:"--label"`
+	Headers map[string]string `cli:"--header"`
+}
+
+func (a mapArgs) AutocompleteKey_Labels() []string {
+	return []string{"env", "team"}
+}
+
+func (a mapArgs) AutocompleteValue_Labels(key string) []string {
+	if key == "env" {
+		return []string{"dev", "prod"}
+	}
+
+	return nil
+}
+
+func (a mapArgs) AutocompleteKey_Headers() []string {
+	return []string{"Accept"}
+}
+
+func TestAutocomplete_MapAutocomplete(t *testing.T) {
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ mapArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]string{"env=dev", "env=prod"},
+		autocompleter.Autocomplete(tree, []string{"cmd", "--label"}, nil))
+	assert.Equal(t,
+		[]string{"Accept="},
+		autocompleter.Autocomplete(tree, []string{"cmd", "--header"}, nil))
+}
+
 func TestAutocomplete_ExecutableWithSubcommands(t *testing.T) {
 	tree, err := cmdtree.New([]interface{}{
 		func(_ context.Context, _ sub1Args) error { return nil },
@@ -129,11 +166,268 @@ func TestAutocomplete_ExecutableWithSubcommands(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t,
 		[]string{"-x", "-y", "-z", "sub1", "sub2"},
-		autocompleter.Autocomplete(tree, []string{"cmd"}))
+		autocompleter.Autocomplete(tree, []string{"cmd"}, nil))
 	assert.Equal(t,
 		[]string{"-a"},
-		autocompleter.Autocomplete(tree, []string{"cmd", "sub1"}))
+		autocompleter.Autocomplete(tree, []string{"cmd", "sub1"}, nil))
 	assert.Equal(t,
 		[]string{"-b"},
-		autocompleter.Autocomplete(tree, []string{"cmd", "sub2"}))
+		autocompleter.Autocomplete(tree, []string{"cmd", "sub2"}, nil))
+}
+
+func TestAutocomplete_Aliases(t *testing.T) {
+	type rootArgs struct{}
+
+	type removeArgs struct {
+		Root rootArgs `cli:"remove,subcmd" aliases:"rm"`
+	}
+
+	type listArgs struct {
+		Root rootArgs `cli:"list,subcmd" aliases:"ls" hidealiases:"true"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ removeArgs) error { return nil },
+		func(_ context.Context, _ listArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]string{"list", "remove", "rm"},
+		autocompleter.Autocomplete(tree, []string{"cmd"}, nil))
+}
+
+func TestAutocomplete_ParentPosArgs(t *testing.T) {
+	type rootArgs struct {
+		Project string `cli:"project" enum:"foo,bar"`
+	}
+
+	type deployArgs struct {
+		Root rootArgs `cli:"deploy,subcmd"`
+	}
+
+	type statusArgs struct {
+		Root rootArgs `cli:"status,subcmd"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ deployArgs) error { return nil },
+		func(_ context.Context, _ statusArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]string{"bar", "foo"},
+		autocompleter.Autocomplete(tree, []string{"cmd"}, nil))
+	assert.Equal(t,
+		[]string{"deploy", "status"},
+		autocompleter.Autocomplete(tree, []string{"cmd", "foo"}, nil))
+}
+
+type persistentArgs struct {
+	Context string `cli:"--context" persistent:"true"`
+	User    string `cli:"--user" persistent:"true"`
+	Force   bool   `cli:"-f"`
+}
+
+func (a persistentArgs) Autocomplete_User() []string {
+	return []string{a.Context + "-admin"}
+}
+
+func TestAutocomplete_PersistentFlags(t *testing.T) {
+	type deployArgs struct {
+		Root   persistentArgs `cli:"deploy,subcmd"`
+		DryRun bool           `cli:"-n"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ deployArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]string{"--context", "--user", "-n"},
+		autocompleter.Autocomplete(tree, []string{"cmd", "deploy"}, nil))
+	assert.Equal(t,
+		[]string{"--user", "-n"},
+		autocompleter.Autocomplete(tree, []string{"cmd", "deploy", "--context", "prod"}, nil))
+	assert.Equal(t,
+		[]string{"prod-admin"},
+		autocompleter.Autocomplete(tree, []string{"cmd", "--context=prod", "deploy", "--user"}, nil))
+}
+
+func TestAutocomplete_DefaultsAndEnvVars(t *testing.T) {
+	type args struct {
+		A string `cli:"-a" env:"ALPHA"`
+		B string `cli:"-b" env:"BRAVO" default:"xxx"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	lookupEnv := func(k string) (string, bool) {
+		if k == "ALPHA" {
+			return "xxx", true
+		}
+
+		return "", false
+	}
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-b"}, autocompleter.Autocomplete(tree, []string{"cmd"}, lookupEnv))
+}
+
+func TestAutocomplete_RequiredFlags(t *testing.T) {
+	type args struct {
+		A string `cli:"-a"`
+		B string `cli:"--bravo"`
+		Y string `cli:"-y" required:"true"`
+		Z string `cli:"-z" required:"true"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]string{"-y", "-z", "--bravo", "-a"},
+		autocompleter.Autocomplete(tree, []string{"cmd"}, nil))
+	assert.Equal(t,
+		[]string{"-y", "--bravo", "-a"},
+		autocompleter.Autocomplete(tree, []string{"cmd", "-zxxx"}, nil))
+}
+
+func TestAutocomplete_Enum(t *testing.T) {
+	type args struct {
+		Output string `cli:"-o,--output" enum:"json,yaml"`
+		Kind   string `cli:"kind" enum:"pod,node"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]string{"json", "yaml"},
+		autocompleter.Autocomplete(tree, []string{"cmd", "--output"}, nil))
+	assert.Equal(t,
+		[]string{"node", "pod"},
+		autocompleter.Autocomplete(tree, []string{"cmd", "-ojson"}, nil))
+}
+
+func TestAutocomplete_Negatable(t *testing.T) {
+	type args struct {
+		Color bool `cli:"--color" negatable:"true"`
+		Force bool `cli:"--force"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]string{"--color", "--force", "--no-color"},
+		autocompleter.Autocomplete(tree, []string{"cmd"}, nil))
+	assert.Equal(t,
+		[]string{"--force"},
+		autocompleter.Autocomplete(tree, []string{"cmd", "--no-color"}, nil))
+}
+
+func TestAutocomplete_Counter(t *testing.T) {
+	type args struct {
+		Verbose int  `cli:"-v" counter:"true"`
+		Force   bool `cli:"-f"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]string{"-v"},
+		autocompleter.Autocomplete(tree, []string{"cmd", "-vvf"}, nil))
+}
+
+type region string
+
+func TestAutocomplete_RegisteredParser(t *testing.T) {
+	param.Register(reflect.TypeOf(region("")), param.Parser{
+		Parse: func(s string) (reflect.Value, error) {
+			return reflect.ValueOf(region(s)), nil
+		},
+		Autocomplete: func() []string { return []string{"us-east-1", "eu-west-1"} },
+	})
+
+	type args struct {
+		Region  region   `cli:"--region"`
+		Primary region   `cli:"--primary" enum:"us-east-1"`
+		Regions []region `cli:"regions..."`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]string{"us-east-1", "eu-west-1"},
+		autocompleter.Autocomplete(tree, []string{"cmd", "--region"}, nil))
+	assert.Equal(t,
+		[]string{"us-east-1"},
+		autocompleter.Autocomplete(tree, []string{"cmd", "--primary"}, nil))
+	assert.Equal(t,
+		[]string{"eu-west-1", "us-east-1"},
+		autocompleter.Autocomplete(tree, []string{"cmd", "--"}, nil))
+}
+
+func TestAutocomplete_TrailingMaxArgs(t *testing.T) {
+	type args struct {
+		Files []string `cli:"files..." enum:"a,b" maxargs:"2"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]string{"a", "b"},
+		autocompleter.Autocomplete(tree, []string{"cmd", "--", "a"}, nil))
+	assert.Empty(t, autocompleter.Autocomplete(tree, []string{"cmd", "--", "a", "b"}, nil))
+}
+
+func TestAutocomplete_PosArgsAfterTrailing(t *testing.T) {
+	type args struct {
+		Src  []string `cli:"src..." enum:"a,b" minargs:"1" maxargs:"2"`
+		Dest string   `cli:"dest" enum:"x,y"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+
+	// The first arg must be a source, since there must be at least one.
+	assert.Equal(t,
+		[]string{"a", "b"},
+		autocompleter.Autocomplete(tree, []string{"cp", "--"}, nil))
+
+	// The second arg could be either.
+	assert.Equal(t,
+		[]string{"a", "b", "x", "y"},
+		autocompleter.Autocomplete(tree, []string{"cp", "--", "a"}, nil))
+
+	// The third arg must be the destination, since there are at most two
+	// sources.
+	assert.Equal(t,
+		[]string{"x", "y"},
+		autocompleter.Autocomplete(tree, []string{"cp", "--", "a", "b"}, nil))
+
+	assert.Empty(t, autocompleter.Autocomplete(tree, []string{"cp", "--", "a", "b", "x"}, nil))
 }
@@ -13,49 +13,24 @@ import (
 	"github.com/ucarion/cli/internal/param"
 )
 
-func Help(tree cmdtree.CommandTree, name []string) string {
+// Help returns the help message of the command in tree. The command's name is
+// name, and ancestors are the commands above it, from the root down.
+func Help(tree cmdtree.CommandTree, ancestors []cmdtree.CommandTree, name []string) string {
 	var buf bytes.Buffer
 
-	// First, write the beginning of the usage line.
-	fmt.Fprintf(&buf, "usage: %s [<options>]", strings.Join(name, " "))
-
-	// Next, we'll write either the valid sub-commands or the valid positional
-	// arguments of the command.
-	if tree.Children != nil {
-		// The command has sub-commands, so we'll output those.
-		children := []string{}
-		for k := range tree.Children {
-			children = append(children, k)
-		}
-
-		sort.Strings(children)
-
-		// If the tree is itself executable, then sub-commands are optional and
-		// so are wrapped in square brackets.
-		if tree.Func.IsValid() {
-			fmt.Fprintf(&buf, " [%s]", strings.Join(children, "|"))
-		} else {
-			fmt.Fprintf(&buf, " %s", strings.Join(children, "|"))
-		}
-	} else {
-		// The command doesn't have sub-commands, so we'll output positional
-		// args, if there are any.
-		posArgs := []string{}
-		for _, a := range tree.PosArgs {
-			posArgs = append(posArgs, a.Name)
-		}
-
-		if tree.Trailing.FieldIndex != nil {
-			posArgs = append(posArgs, tree.Trailing.Name+"...")
-		}
+	// First, write the usage line.
+	buf.WriteString(Usage(tree, ancestors, name))
+	buf.WriteByte('\n')
 
-		if len(posArgs) != 0 {
-			fmt.Fprintf(&buf, " %s", strings.Join(posArgs, " "))
-		}
+	// If the command has aliases, list them right below the usage line.
+	if len(tree.Aliases) != 0 {
+		fmt.Fprintf(&buf, "aliases: %s\n", strings.Join(tree.Aliases, ", "))
 	}
 
-	// Finish the initial usage line.
-	buf.WriteByte('\n')
+	// Likewise for the default sub-command, if there is one.
+	if tree.DefaultSubcommand != "" {
+		fmt.Fprintf(&buf, "default sub-command: %s\n", tree.DefaultSubcommand)
+	}
 
 	// If there's an extended description, write it out with surrounding
 	// newlines.
@@ -67,43 +42,225 @@ func Help(tree cmdtree.CommandTree, name []string) string {
 	buf.WriteByte('\n')
 
 	// Write out the flags.
-	w := tabwriter.NewWriter(&buf, 0, 0, 1, ' ', 0)
-	for _, f := range tree.Flags {
-		valueName := f.ValueName
-		if valueName == "" {
-			valueName = flagValueType(tree, f).String()
-		}
+	writeFlags(&buf, tree, tree.Flags)
 
-		var valuePart string
-		switch {
-		case mustTakeValue(tree, f):
-			valuePart = fmt.Sprintf(" <%s>", valueName)
-		case mayTakeValue(tree, f):
-			valuePart = fmt.Sprintf("[=<%s>]", valueName)
+	// Write out the flags inherited from ancestors, if there are any, in a
+	// section of their own.
+	if len(tree.InheritedFlags) != 0 {
+		buf.WriteString("\nInherited options:\n")
+		writeFlags(&buf, tree, tree.InheritedFlags)
+	}
+
+	// Add one last empty line to make the output more clearly separated from
+	// the subsequent CLI prompt.
+	buf.WriteByte('\n')
+
+	return buf.String()
+}
+
+// writeFlags writes out a line for each of flags, which are flags of tree.
+func writeFlags(buf *bytes.Buffer, tree cmdtree.CommandTree, flags []command.Flag) {
+	w := tabwriter.NewWriter(buf, 0, 0, 1, ' ', 0)
+	for _, f := range flags {
+		valuePart := flagValuePart(tree, f)
+
+		// Negatable flags show both their forms at once.
+		longName := f.LongName
+		if f.Negatable {
+			longName = "[" + command.NegatedPrefix + "]" + longName
 		}
 
 		var flagLine string
 		switch {
 		case f.ShortName == "":
-			flagLine = fmt.Sprintf("    --%s%s", f.LongName, valuePart)
+			flagLine = fmt.Sprintf("    --%s%s", longName, valuePart)
 		case f.LongName == "":
 			flagLine = fmt.Sprintf("-%s%s", f.ShortName, valuePart)
 		default:
-			flagLine = fmt.Sprintf("-%s, --%s%s", f.ShortName, f.LongName, valuePart)
+			flagLine = fmt.Sprintf("-%s, --%s%s", f.ShortName, longName, valuePart)
 		}
 
-		fmt.Fprintf(w, "    %s\t   %s\n", flagLine, f.Usage)
+		fmt.Fprintf(w, "    %s\t   %s\n", flagLine, flagUsage(f))
 	}
 
 	w.Flush()
+}
 
-	// Add one last empty line to make the output more clearly separated from
-	// the subsequent CLI prompt.
-	buf.WriteByte('\n')
+// Usage returns the usage line of the command in tree, without a trailing
+// newline. The command's name is name, and ancestors are the commands above it,
+// from the root down.
+func Usage(tree cmdtree.CommandTree, ancestors []cmdtree.CommandTree, name []string) string {
+	var buf bytes.Buffer
+
+	// First, write the beginning of the usage line. Each ancestor's options
+	// and positional arguments go right after its name, before the name of
+	// the next command down.
+	buf.WriteString("usage:")
+	for i, a := range ancestors {
+		fmt.Fprintf(&buf, " %s [<options>]", name[i])
+		if posArgs := posArgsParts(a); len(posArgs) != 0 {
+			fmt.Fprintf(&buf, " %s", strings.Join(posArgs, " "))
+		}
+	}
+
+	fmt.Fprintf(&buf, " %s [<options>]", strings.Join(name[len(ancestors):], " "))
+
+	// Required flags aren't optional, so they're called out separately from the
+	// rest of the options. This includes the ones inherited from ancestors,
+	// since they can be given here too.
+	for _, f := range tree.AllFlags() {
+		if f.Required {
+			fmt.Fprintf(&buf, " %s%s", f.DisplayName(), flagValuePart(tree, f))
+		}
+	}
+
+	// Flags that are constrained together are also called out, so that users
+	// can see which ones go together.
+	for _, g := range tree.ExclusiveGroups() {
+		fmt.Fprintf(&buf, " [%s]", flagGroupPart(tree, g))
+	}
+
+	for _, g := range tree.AnyOfGroups() {
+		fmt.Fprintf(&buf, " (%s)", flagGroupPart(tree, g))
+	}
+
+	// Next, we'll write the positional arguments of the command, if there are
+	// any.
+	if posArgs := posArgsParts(tree); len(posArgs) != 0 {
+		fmt.Fprintf(&buf, " %s", strings.Join(posArgs, " "))
+	}
+
+	// Then, we'll write the valid sub-commands, if there are any. They come
+	// after the positional arguments of the command, which parent commands
+	// take before the sub-command's name.
+	if tree.Children != nil {
+		children := []string{}
+		for k := range tree.Children {
+			children = append(children, k)
+		}
+
+		sort.Strings(children)
+
+		// If the tree is itself executable or has a default sub-command, then
+		// sub-commands are optional and so are wrapped in square brackets.
+		if tree.Func.IsValid() || tree.DefaultSubcommand != "" {
+			fmt.Fprintf(&buf, " [%s]", strings.Join(children, "|"))
+		} else {
+			fmt.Fprintf(&buf, " %s", strings.Join(children, "|"))
+		}
+	}
 
 	return buf.String()
 }
 
+func flagUsage(flag command.Flag) string {
+	// Notes about the flag go after its usage, in parentheses.
+	notes := []string{}
+	if flag.Default != "" {
+		notes = append(notes, fmt.Sprintf("(default: %s)", flag.Default))
+	}
+
+	if flag.EnvVar != "" {
+		notes = append(notes, fmt.Sprintf("(env: %s)", flag.EnvVar))
+	}
+
+	if len(flag.Requires) != 0 {
+		notes = append(notes, fmt.Sprintf("(requires: %s)", strings.Join(flag.Requires, ", ")))
+	}
+
+	if flag.ParamOptions.Counter {
+		notes = append(notes, "(repeatable)")
+	}
+
+	if flag.Usage != "" {
+		notes = append([]string{flag.Usage}, notes...)
+	}
+
+	return strings.Join(notes, " ")
+}
+
+// posArgsParts returns the synopsis of each of the positional arguments of the
+// command in tree. Optional ones are wrapped in square brackets.
+func posArgsParts(tree cmdtree.CommandTree) []string {
+	posArgs := []string{}
+	for _, a := range tree.PosArgs {
+		if a.Optional {
+			posArgs = append(posArgs, fmt.Sprintf("[<%s>]", posArgValueName(a)))
+		} else {
+			posArgs = append(posArgs, fmt.Sprintf("<%s>", posArgValueName(a)))
+		}
+	}
+
+	if tree.Trailing.FieldIndex != nil {
+		if tree.Trailing.MinArgs == 0 {
+			posArgs = append(posArgs, fmt.Sprintf("[<%s>...]", posArgValueName(tree.Trailing)))
+		} else {
+			posArgs = append(posArgs, fmt.Sprintf("<%s>...", posArgValueName(tree.Trailing)))
+		}
+	}
+
+	for _, a := range tree.AfterTrailing {
+		posArgs = append(posArgs, fmt.Sprintf("<%s>", posArgValueName(a)))
+	}
+
+	return posArgs
+}
+
+// flagGroupPart returns the synopsis of a group of flags, as alternatives
+// separated by pipes.
+func flagGroupPart(tree cmdtree.CommandTree, g command.FlagGroup) string {
+	parts := []string{}
+	for _, f := range g.Flags {
+		parts = append(parts, f.DisplayName()+flagValuePart(tree, f))
+	}
+
+	return strings.Join(parts, " | ")
+}
+
+// posArgValueName returns the name to show for an argument's value. Like for
+// flags, an argument restricted to an enum shows its values.
+func posArgValueName(a command.PosArg) string {
+	if len(a.Enum) != 0 {
+		return strings.Join(a.Enum, "|")
+	}
+
+	return a.Name
+}
+
+// flagValuePart returns the part of a flag's synopsis that comes after its name,
+// describing the value the flag takes, if any.
+func flagValuePart(tree cmdtree.CommandTree, flag command.Flag) string {
+	valueName := flag.ValueName
+	if valueName == "" && len(flag.Enum) != 0 {
+		valueName = strings.Join(flag.Enum, "|")
+	}
+
+	if valueName == "" && flag.FieldIndex != nil {
+		// Each of the values given to a flag with a separator is an element of
+		// the flag's slice.
+		t := flagValueType(tree, flag)
+		if flag.ParamOptions.Separator != "" {
+			t = t.Elem()
+		}
+
+		valueName = param.ValueNameWithOptions(t, flag.ParamOptions)
+	}
+
+	// Flags with a separator can take several values at once.
+	if flag.ParamOptions.Separator != "" {
+		return fmt.Sprintf(" <%s>[%s...]", valueName, flag.ParamOptions.Separator)
+	}
+
+	switch {
+	case mustTakeValue(tree, flag):
+		return fmt.Sprintf(" <%s>", valueName)
+	case mayTakeValue(tree, flag):
+		return fmt.Sprintf("[=<%s>]", valueName)
+	default:
+		return ""
+	}
+}
+
 func flagValueType(tree cmdtree.CommandTree, flag command.Flag) reflect.Type {
 	return tree.Config.FieldByIndex(flag.FieldIndex).Type
 }
@@ -113,8 +270,12 @@ func mayTakeValue(tree cmdtree.CommandTree, flag command.Flag) bool {
 		return false
 	}
 
+	if flag.IsTimeout {
+		return true
+	}
+
 	config := reflect.New(tree.Config).Elem()
-	p, _ := param.New(config.FieldByIndex(flag.FieldIndex).Addr().Interface())
+	p, _ := param.NewWithOptions(config.FieldByIndex(flag.FieldIndex).Addr().Interface(), flag.ParamOptions)
 	return param.MayTakeValue(p)
 }
 
@@ -123,7 +284,11 @@ func mustTakeValue(tree cmdtree.CommandTree, flag command.Flag) bool {
 		return false
 	}
 
+	if flag.IsTimeout {
+		return true
+	}
+
 	config := reflect.New(tree.Config).Elem()
-	p, _ := param.New(config.FieldByIndex(flag.FieldIndex).Addr().Interface())
+	p, _ := param.NewWithOptions(config.FieldByIndex(flag.FieldIndex).Addr().Interface(), flag.ParamOptions)
 	return param.MustTakeValue(p)
 }
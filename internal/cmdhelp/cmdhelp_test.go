@@ -2,11 +2,16 @@ package cmdhelp_test
 
 import (
 	"context"
+	"net"
+	"net/netip"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/ucarion/cli/internal/cmdhelp"
 	"github.com/ucarion/cli/internal/cmdtree"
+	"github.com/ucarion/cli/internal/param"
 )
 
 func TestHelp_Basic(t *testing.T) {
@@ -21,7 +26,7 @@ func TestHelp_Basic(t *testing.T) {
 
     -h, --help    display this help and exit
 
-`, cmdhelp.Help(tree, []string{"./cmd"}))
+`, cmdhelp.Help(tree, nil, []string{"./cmd"}))
 }
 
 type gamutArgs struct {
@@ -44,7 +49,7 @@ func TestHelp_Gamut(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.Equal(t,
-		`usage: ./cmd [<options>] foo bar baz...
+		`usage: ./cmd [<options>] <foo> <bar> [<baz>...]
 
 this is an extended description
 
@@ -53,7 +58,7 @@ this is an extended description
         --zulu[=<zzz>]    do some z stuff
     -h, --help            display this help and exit
 
-`, cmdhelp.Help(tree, []string{"./cmd"}))
+`, cmdhelp.Help(tree, nil, []string{"./cmd"}))
 }
 
 type rootArgs struct {
@@ -92,7 +97,7 @@ this is an extended description
         --zulu[=<zzz>]    do some z stuff
     -h, --help            display this help and exit
 
-`, cmdhelp.Help(tree, []string{"./cmd"}))
+`, cmdhelp.Help(tree, nil, []string{"./cmd"}))
 }
 
 func TestHelp_NonExecutableWithSubcommands(t *testing.T) {
@@ -112,5 +117,309 @@ this is an extended description
         --zulu[=<zzz>]    do some z stuff
     -h, --help            display this help and exit
 
-`, cmdhelp.Help(tree, []string{"./cmd"}))
+`, cmdhelp.Help(tree, nil, []string{"./cmd"}))
+}
+
+func TestHelp_ParentPosArgs(t *testing.T) {
+	type rootArgs struct {
+		Project string `cli:"project"`
+	}
+
+	type deployArgs struct {
+		Root rootArgs `cli:"deploy,subcmd"`
+	}
+
+	type statusArgs struct {
+		Root rootArgs `cli:"status,subcmd"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ deployArgs) error { return nil },
+		func(_ context.Context, _ statusArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "usage: cmd [<options>] <project> deploy|status", cmdhelp.Usage(tree, nil, []string{"cmd"}))
+}
+
+func TestHelp_Ancestors(t *testing.T) {
+	type rootArgs struct {
+		Project string `cli:"project"`
+	}
+
+	type deployArgs struct {
+		Root rootArgs `cli:"deploy,subcmd"`
+		Env  string   `cli:"env"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ deployArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"usage: cmd [<options>] <project> deploy [<options>] <env>",
+		cmdhelp.Usage(tree.Children["deploy"].CommandTree, []cmdtree.CommandTree{tree}, []string{"cmd", "deploy"}))
+}
+
+func TestHelp_DefaultsAndEnvVars(t *testing.T) {
+	type args struct {
+		Token string `cli:"--token" env:"FOO_TOKEN" default:"xxx" usage:"api token"`
+		Force bool   `cli:"-f,--force"`
+		X     string `cli:"-x"`
+	}
+
+	tree, err := cmdtree.NewWithOptions([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	}, cmdtree.Options{EnvPrefix: "CMD"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `usage: ./cmd [<options>]
+
+        --token <string>    api token (default: xxx) (env: FOO_TOKEN)
+    -f, --force             (env: CMD_FORCE)
+    -x <string>             
+    -h, --help              display this help and exit
+
+`, cmdhelp.Help(tree, nil, []string{"./cmd"}))
+}
+
+func TestHelp_RequiredFlags(t *testing.T) {
+	type args struct {
+		Project string `cli:"-p,--project" value:"name" required:"true"`
+		Force   bool   `cli:"-f" required:"true"`
+		X       string `cli:"x"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `usage: ./cmd [<options>] --project <name> -f <x>
+
+    -p, --project <name>    
+    -f                      
+    -h, --help              display this help and exit
+
+`, cmdhelp.Help(tree, nil, []string{"./cmd"}))
+}
+
+func TestHelp_Enum(t *testing.T) {
+	type args struct {
+		Output string `cli:"-o,--output" enum:"json,yaml"`
+		Format string `cli:"--format" value:"format" enum:"a,b"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `usage: ./cmd [<options>]
+
+    -o, --output <json|yaml>    
+        --format <format>       
+    -h, --help                  display this help and exit
+
+`, cmdhelp.Help(tree, nil, []string{"./cmd"}))
+}
+
+func TestHelp_EnumPosArgs(t *testing.T) {
+	type args struct {
+		Output string   `cli:"output" enum:"json,yaml"`
+		Levels []string `cli:"levels..." enum:"debug,info"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `usage: ./cmd [<options>] <json|yaml> [<debug|info>...]
+
+    -h, --help    display this help and exit
+
+`, cmdhelp.Help(tree, nil, []string{"./cmd"}))
+}
+
+func TestHelp_FlagGroups(t *testing.T) {
+	type args struct {
+		JSON     bool   `cli:"--json" exclusive:"output"`
+		Table    bool   `cli:"--table" exclusive:"output"`
+		Cert     string `cli:"--cert" value:"path" requires:"--key"`
+		Key      string `cli:"--key" value:"path"`
+		Token    string `cli:"--token" value:"token" anyof:"auth"`
+		Password string `cli:"--password" value:"password" anyof:"auth"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `usage: ./cmd [<options>] [--json | --table] (--token <token> | --password <password>)
+
+        --json                   
+        --table                  
+        --cert <path>            (requires: --key)
+        --key <path>             
+        --token <token>          
+        --password <password>    
+    -h, --help                   display this help and exit
+
+`, cmdhelp.Help(tree, nil, []string{"./cmd"}))
+}
+
+func TestHelp_Negatable(t *testing.T) {
+	type args struct {
+		Color bool  `cli:"-c,--color" negatable:"true"`
+		Cache *bool `cli:"--cache" negatable:"true"`
+		Force bool  `cli:"--force"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `usage: ./cmd [<options>]
+
+    -c, --[no-]color    
+        --[no-]cache    
+        --force         
+    -h, --help          display this help and exit
+
+`, cmdhelp.Help(tree, nil, []string{"./cmd"}))
+}
+
+func TestHelp_Counter(t *testing.T) {
+	type args struct {
+		Verbose int `cli:"-v,--verbose" counter:"true" usage:"be more verbose"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `usage: ./cmd [<options>]
+
+    -v, --verbose    be more verbose (repeatable)
+    -h, --help       display this help and exit
+
+`, cmdhelp.Help(tree, nil, []string{"./cmd"}))
+}
+
+func TestHelp_Map(t *testing.T) {
+	type args struct {
+		Labels map[string]string `cli:"-l,--label"`
+		Env    map[string]string `cli:"--env" value:"name=value"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `usage: ./cmd [<options>]
+
+    -l, --label <key=value>    
+        --env <name=value>     
+    -h, --help                 display this help and exit
+
+`, cmdhelp.Help(tree, nil, []string{"./cmd"}))
+}
+
+func TestHelp_Separator(t *testing.T) {
+	type args struct {
+		Tags  []string        `cli:"-t,--tags" value:"tag" sep:","`
+		Names []string        `cli:"--names" sep:","`
+		Waits []time.Duration `cli:"--waits" sep:":"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `usage: ./cmd [<options>]
+
+    -t, --tags <tag>[,...]          
+        --names <string>[,...]      
+        --waits <duration>[:...]    
+    -h, --help                      display this help and exit
+
+`, cmdhelp.Help(tree, nil, []string{"./cmd"}))
+}
+
+func TestHelp_FriendlyValueNames(t *testing.T) {
+	type args struct {
+		Wait  time.Duration  `cli:"--wait"`
+		Since time.Time      `cli:"--since"`
+		Limit param.ByteSize `cli:"--limit"`
+		IP    net.IP         `cli:"--ip"`
+		Allow netip.Prefix   `cli:"--allow"`
+		Addr  param.HostPort `cli:"--addr"`
+		URL   *url.URL       `cli:"--url"`
+		Query struct{}       `cli:"--query" format:"json"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `usage: ./cmd [<options>]
+
+        --wait <duration>     
+        --since <time>        
+        --limit <size>        
+        --ip <ip>             
+        --allow <cidr>        
+        --addr <host:port>    
+        --url <url>           
+        --query <json>        
+    -h, --help                display this help and exit
+
+`, cmdhelp.Help(tree, nil, []string{"./cmd"}))
+}
+
+func TestHelp_OptionalPosArgs(t *testing.T) {
+	type diffArgs struct {
+		A string  `cli:"a"`
+		B *string `cli:"b"`
+	}
+
+	type killArgs struct {
+		PIDs []int `cli:"pid..." minargs:"1"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ diffArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "usage: diff [<options>] <a> [<b>]", cmdhelp.Usage(tree, nil, []string{"diff"}))
+
+	tree, err = cmdtree.New([]interface{}{
+		func(_ context.Context, _ killArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "usage: kill [<options>] <pid>...", cmdhelp.Usage(tree, nil, []string{"kill"}))
+}
+
+func TestHelp_PosArgsAfterTrailing(t *testing.T) {
+	type args struct {
+		Src  []string `cli:"src..." minargs:"1"`
+		Dest string   `cli:"dest"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "usage: cp [<options>] <src>... <dest>", cmdhelp.Usage(tree, nil, []string{"cp"}))
 }
@@ -15,20 +15,23 @@ import (
 
 func Man(tree cmdtree.CommandTree, name string) map[string]string {
 	out := map[string]string{}
-	walk(out, tree, []string{filepath.Base(name)})
+	walk(out, tree, nil, []string{filepath.Base(name)})
 	return out
 }
 
-func walk(out map[string]string, tree cmdtree.CommandTree, name []string) {
-	k, v := man(tree, name)
+// walk adds the man pages of tree and the commands below it to out. The
+// command's name is name, and ancestors are the commands above it, from the
+// root down.
+func walk(out map[string]string, tree cmdtree.CommandTree, ancestors []cmdtree.CommandTree, name []string) {
+	k, v := man(tree, ancestors, name)
 	out[k] = v
 
 	for childName, child := range tree.Children {
-		walk(out, child.CommandTree, append(name, childName))
+		walk(out, child.CommandTree, append(ancestors, tree), append(name, childName))
 	}
 }
 
-func man(tree cmdtree.CommandTree, name []string) (string, string) {
+func man(tree cmdtree.CommandTree, ancestors []cmdtree.CommandTree, name []string) (string, string) {
 	var buf bytes.Buffer
 
 	// Initial header line.
@@ -46,21 +49,64 @@ func man(tree cmdtree.CommandTree, name []string) (string, string) {
 	// foo
 	//
 	// Where "foo" is determined by the given name, and "does foo things" is the
-	// short description of the command.
+	// short description of the command. If the command has aliases, they're
+	// listed alongside "foo", like "foo, f".
+	names := []string{strings.Join(name, "-")}
+	for _, alias := range tree.Aliases {
+		aliasName := append(append([]string{}, name[:len(name)-1]...), alias)
+		names = append(names, strings.Join(aliasName, "-"))
+	}
+
 	if tree.Description != "" {
-		fmt.Fprintf(&buf, "%s - %s\n", strings.Join(name, "-"), tree.Description)
+		fmt.Fprintf(&buf, "%s - %s\n", strings.Join(names, ", "), tree.Description)
 	} else {
-		fmt.Fprintln(&buf, strings.Join(name, "-"))
+		fmt.Fprintln(&buf, strings.Join(names, ", "))
 	}
 
-	// Synopsis section. This should show how you can invoke the program.
+	// Synopsis section. This should show how you can invoke the program. Each
+	// ancestor's options and positional arguments go right after its name,
+	// before the name of the next command down.
 	fmt.Fprintln(&buf, ".SH SYNOPSIS")
-	fmt.Fprintf(&buf, "\\fI%s\\fR [<options>]", strings.Join(name, " "))
+	for i, a := range ancestors {
+		fmt.Fprintf(&buf, "\\fI%s\\fR [<options>]", name[i])
+		if posArgs := posArgsParts(a); len(posArgs) != 0 {
+			fmt.Fprintf(&buf, " %s", strings.Join(posArgs, " "))
+		}
+
+		buf.WriteString(" ")
+	}
+
+	fmt.Fprintf(&buf, "\\fI%s\\fR [<options>]", strings.Join(name[len(ancestors):], " "))
+
+	// Required flags aren't optional, so they're called out separately from the
+	// rest of the options. This includes the ones inherited from ancestors,
+	// since they can be given here too.
+	for _, f := range tree.AllFlags() {
+		if f.Required {
+			fmt.Fprintf(&buf, " %s%s", f.DisplayName(), flagValuePart(tree, f))
+		}
+	}
+
+	// Flags that are constrained together are also called out, so that users
+	// can see which ones go together.
+	for _, g := range tree.ExclusiveGroups() {
+		fmt.Fprintf(&buf, " [%s]", flagGroupPart(tree, g))
+	}
+
+	for _, g := range tree.AnyOfGroups() {
+		fmt.Fprintf(&buf, " (%s)", flagGroupPart(tree, g))
+	}
 
-	// Next, we'll write either the valid sub-commands or the valid positional
-	// arguments of the command.
+	// Next, we'll write the positional arguments of the command, if there are
+	// any.
+	if posArgs := posArgsParts(tree); len(posArgs) != 0 {
+		fmt.Fprintf(&buf, " %s", strings.Join(posArgs, " "))
+	}
+
+	// Then, we'll write the valid sub-commands, if there are any. They come
+	// after the positional arguments of the command, which parent commands
+	// take before the sub-command's name.
 	if tree.Children != nil {
-		// The command has sub-commands, so we'll output those.
 		children := []string{}
 		for k := range tree.Children {
 			children = append(children, k)
@@ -68,28 +114,13 @@ func man(tree cmdtree.CommandTree, name []string) (string, string) {
 
 		sort.Strings(children)
 
-		// If the tree is itself executable, then sub-commands are optional and
-		// so are wrapped in square brackets.
-		if tree.Func.IsValid() {
+		// If the tree is itself executable or has a default sub-command, then
+		// sub-commands are optional and so are wrapped in square brackets.
+		if tree.Func.IsValid() || tree.DefaultSubcommand != "" {
 			fmt.Fprintf(&buf, " [%s]", strings.Join(children, " | "))
 		} else {
 			fmt.Fprintf(&buf, " %s", strings.Join(children, " | "))
 		}
-	} else {
-		// The command doesn't have sub-commands, so we'll output positional
-		// args, if there are any.
-		posArgs := []string{}
-		for _, a := range tree.PosArgs {
-			posArgs = append(posArgs, a.Name)
-		}
-
-		if tree.Trailing.FieldIndex != nil {
-			posArgs = append(posArgs, tree.Trailing.Name+"...")
-		}
-
-		if len(posArgs) != 0 {
-			fmt.Fprintf(&buf, " %s", strings.Join(posArgs, " "))
-		}
 	}
 
 	buf.WriteByte('\n')
@@ -101,43 +132,171 @@ func man(tree cmdtree.CommandTree, name []string) (string, string) {
 	fmt.Fprintln(&buf, ".SH DESCRIPTION")
 	fmt.Fprintln(&buf, tree.ExtendedDescription)
 
+	// If the command has a default sub-command, say what running the command
+	// on its own does.
+	if tree.DefaultSubcommand != "" {
+		defaultName := append(append([]string{}, name...), tree.DefaultSubcommand)
+		fmt.Fprintln(&buf, ".PP")
+		fmt.Fprintf(&buf, "Without a sub-command, runs \\fI%s\\fR.\n", strings.Join(defaultName, " "))
+	}
+
 	// Options section. This details each of the flags and their extended
 	// usages.
 	fmt.Fprintln(&buf, ".SH OPTIONS")
-	for _, f := range tree.Flags {
-		valueName := f.ValueName
-		if valueName == "" {
-			valueName = flagValueType(tree, f).String()
+	writeFlags(&buf, tree, tree.Flags)
+
+	// Inherited options section. This details the flags inherited from
+	// ancestors, if there are any.
+	if len(tree.InheritedFlags) != 0 {
+		fmt.Fprintln(&buf, ".SH INHERITED OPTIONS")
+		writeFlags(&buf, tree, tree.InheritedFlags)
+	}
+
+	// Environment section. This lists the environment variables that options
+	// fall back to, if there are any, including inherited options.
+	envFlags := []command.Flag{}
+	for _, f := range tree.AllFlags() {
+		if f.EnvVar != "" {
+			envFlags = append(envFlags, f)
 		}
+	}
 
-		var valuePart string
-		switch {
-		case mustTakeValue(tree, f):
-			valuePart = fmt.Sprintf(" <%s>", valueName)
-		case mayTakeValue(tree, f):
-			valuePart = fmt.Sprintf("[=<%s>]", valueName)
+	if len(envFlags) != 0 {
+		fmt.Fprintln(&buf, ".SH ENVIRONMENT")
+		for _, f := range envFlags {
+			fmt.Fprintln(&buf, ".TP")
+			fmt.Fprintf(&buf, "%s\n", f.EnvVar)
+			fmt.Fprintf(&buf, "Used as the value of %s if it is not given.\n", f.DisplayName())
+		}
+	}
+
+	// Return the name of the file this man page would go to, and its contents.
+	//
+	// We always want to generate a man page in the "1" section, because that is
+	// where user commands go.
+	return fmt.Sprintf("%s.1", strings.Join(name, "-")), buf.String()
+}
+
+// writeFlags writes out an entry for each of flags, which are flags of tree.
+func writeFlags(buf *bytes.Buffer, tree cmdtree.CommandTree, flags []command.Flag) {
+	for _, f := range flags {
+		valuePart := flagValuePart(tree, f)
+
+		// Negatable flags show both their forms at once.
+		longName := f.LongName
+		if f.Negatable {
+			longName = "[" + command.NegatedPrefix + "]" + longName
 		}
 
 		var flagLine string
 		switch {
 		case f.ShortName == "":
-			flagLine = fmt.Sprintf("--%s%s", f.LongName, valuePart)
+			flagLine = fmt.Sprintf("--%s%s", longName, valuePart)
 		case f.LongName == "":
 			flagLine = fmt.Sprintf("-%s%s", f.ShortName, valuePart)
 		default:
-			flagLine = fmt.Sprintf("-%s, --%s%s", f.ShortName, f.LongName, valuePart)
+			flagLine = fmt.Sprintf("-%s, --%s%s", f.ShortName, longName, valuePart)
+		}
+
+		extendedUsage := f.ExtendedUsage
+		if f.Default != "" {
+			extendedUsage = strings.TrimSpace(fmt.Sprintf("%s (default: %s)", extendedUsage, f.Default))
 		}
 
-		fmt.Fprintln(&buf, ".TP")
-		fmt.Fprintf(&buf, "%s\n", flagLine)
-		fmt.Fprintln(&buf, f.ExtendedUsage)
+		if len(f.Requires) != 0 {
+			extendedUsage = strings.TrimSpace(fmt.Sprintf("%s (requires: %s)", extendedUsage, strings.Join(f.Requires, ", ")))
+		}
+
+		if f.ParamOptions.Counter {
+			extendedUsage = strings.TrimSpace(fmt.Sprintf("%s (repeatable)", extendedUsage))
+		}
+
+		fmt.Fprintln(buf, ".TP")
+		fmt.Fprintf(buf, "%s\n", flagLine)
+		fmt.Fprintln(buf, extendedUsage)
 	}
+}
 
-	// Return the name of the file this man page would go to, and its contents.
-	//
-	// We always want to generate a man page in the "1" section, because that is
-	// where user commands go.
-	return fmt.Sprintf("%s.1", strings.Join(name, "-")), buf.String()
+// flagGroupPart returns the synopsis of a group of flags, as alternatives
+// separated by pipes.
+func flagGroupPart(tree cmdtree.CommandTree, g command.FlagGroup) string {
+	parts := []string{}
+	for _, f := range g.Flags {
+		parts = append(parts, f.DisplayName()+flagValuePart(tree, f))
+	}
+
+	return strings.Join(parts, " | ")
+}
+
+// posArgsParts returns the synopsis of each of the positional arguments of the
+// command in tree. Optional ones are wrapped in square brackets.
+func posArgsParts(tree cmdtree.CommandTree) []string {
+	posArgs := []string{}
+	for _, a := range tree.PosArgs {
+		if a.Optional {
+			posArgs = append(posArgs, fmt.Sprintf("[<%s>]", posArgValueName(a)))
+		} else {
+			posArgs = append(posArgs, fmt.Sprintf("<%s>", posArgValueName(a)))
+		}
+	}
+
+	if tree.Trailing.FieldIndex != nil {
+		if tree.Trailing.MinArgs == 0 {
+			posArgs = append(posArgs, fmt.Sprintf("[<%s>...]", posArgValueName(tree.Trailing)))
+		} else {
+			posArgs = append(posArgs, fmt.Sprintf("<%s>...", posArgValueName(tree.Trailing)))
+		}
+	}
+
+	for _, a := range tree.AfterTrailing {
+		posArgs = append(posArgs, fmt.Sprintf("<%s>", posArgValueName(a)))
+	}
+
+	return posArgs
+}
+
+// posArgValueName returns the name to show for an argument's value. Like for
+// flags, an argument restricted to an enum shows its values.
+func posArgValueName(a command.PosArg) string {
+	if len(a.Enum) != 0 {
+		return strings.Join(a.Enum, "|")
+	}
+
+	return a.Name
+}
+
+// flagValuePart returns the part of a flag's synopsis that comes after its name,
+// describing the value the flag takes, if any.
+func flagValuePart(tree cmdtree.CommandTree, flag command.Flag) string {
+	valueName := flag.ValueName
+	if valueName == "" && len(flag.Enum) != 0 {
+		valueName = strings.Join(flag.Enum, "|")
+	}
+
+	if valueName == "" && flag.FieldIndex != nil {
+		// Each of the values given to a flag with a separator is an element of
+		// the flag's slice.
+		t := flagValueType(tree, flag)
+		if flag.ParamOptions.Separator != "" {
+			t = t.Elem()
+		}
+
+		valueName = param.ValueNameWithOptions(t, flag.ParamOptions)
+	}
+
+	// Flags with a separator can take several values at once.
+	if flag.ParamOptions.Separator != "" {
+		return fmt.Sprintf(" <%s>[%s...]", valueName, flag.ParamOptions.Separator)
+	}
+
+	switch {
+	case mustTakeValue(tree, flag):
+		return fmt.Sprintf(" <%s>", valueName)
+	case mayTakeValue(tree, flag):
+		return fmt.Sprintf("[=<%s>]", valueName)
+	default:
+		return ""
+	}
 }
 
 func flagValueType(tree cmdtree.CommandTree, flag command.Flag) reflect.Type {
@@ -149,8 +308,12 @@ func mayTakeValue(tree cmdtree.CommandTree, flag command.Flag) bool {
 		return false
 	}
 
+	if flag.IsTimeout {
+		return true
+	}
+
 	config := reflect.New(tree.Config).Elem()
-	p, _ := param.New(config.FieldByIndex(flag.FieldIndex).Addr().Interface())
+	p, _ := param.NewWithOptions(config.FieldByIndex(flag.FieldIndex).Addr().Interface(), flag.ParamOptions)
 	return param.MayTakeValue(p)
 }
 
@@ -159,7 +322,11 @@ func mustTakeValue(tree cmdtree.CommandTree, flag command.Flag) bool {
 		return false
 	}
 
+	if flag.IsTimeout {
+		return true
+	}
+
 	config := reflect.New(tree.Config).Elem()
-	p, _ := param.New(config.FieldByIndex(flag.FieldIndex).Addr().Interface())
+	p, _ := param.NewWithOptions(config.FieldByIndex(flag.FieldIndex).Addr().Interface(), flag.ParamOptions)
 	return param.MustTakeValue(p)
 }
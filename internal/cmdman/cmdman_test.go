@@ -68,7 +68,7 @@ func TestMan_Gamut(t *testing.T) {
 .SH NAME
 cmd - this is a short description
 .SH SYNOPSIS
-\fIcmd\fR [<options>] foo bar baz...
+\fIcmd\fR [<options>] <foo> <bar> [<baz>...]
 .SH DESCRIPTION
 this is an extended description
 .SH OPTIONS
@@ -124,7 +124,7 @@ func TestHelp_ExecutableWithSubcommands(t *testing.T) {
 .SH NAME
 cmd-sub1
 .SH SYNOPSIS
-\fIcmd sub1\fR [<options>]
+\fIcmd\fR [<options>] \fIsub1\fR [<options>]
 .SH DESCRIPTION
 
 .SH OPTIONS
@@ -136,7 +136,7 @@ Display help message and exit.
 .SH NAME
 cmd-sub2
 .SH SYNOPSIS
-\fIcmd sub2\fR [<options>]
+\fIcmd\fR [<options>] \fIsub2\fR [<options>]
 .SH DESCRIPTION
 
 .SH OPTIONS
@@ -168,6 +168,181 @@ Display help message and exit.
 	}, cmdman.Man(tree, "./foo/bar/cmd"))
 }
 
+func TestMan_Aliases(t *testing.T) {
+	type rootArgs struct{}
+	type removeArgs struct {
+		Root rootArgs `cli:"remove,subcmd" aliases:"rm,del"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ removeArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `.TH CMD-REMOVE 1
+.SH NAME
+cmd-remove, cmd-rm, cmd-del
+.SH SYNOPSIS
+\fIcmd\fR [<options>] \fIremove\fR [<options>]
+.SH DESCRIPTION
+
+.SH OPTIONS
+.TP
+-h, --help
+Display help message and exit.
+`, cmdman.Man(tree, "cmd")["cmd-remove.1"])
+}
+
+type stashArgs struct{}
+
+func (stashArgs) DefaultSubcommand() string {
+	return "push"
+}
+
+func TestMan_DefaultSubcommand(t *testing.T) {
+	type pushArgs struct {
+		Stash stashArgs `cli:"push,subcmd"`
+	}
+
+	type listArgs struct {
+		Stash stashArgs `cli:"list,subcmd"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ pushArgs) error { return nil },
+		func(_ context.Context, _ listArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `.TH STASH 1
+.SH NAME
+stash
+.SH SYNOPSIS
+\fIstash\fR [<options>] [list | push]
+.SH DESCRIPTION
+
+.PP
+Without a sub-command, runs \fIstash push\fR.
+.SH OPTIONS
+.TP
+-h, --help
+Display help message and exit.
+`, cmdman.Man(tree, "stash")["stash.1"])
+}
+
+func TestMan_ParentPosArgs(t *testing.T) {
+	type rootArgs struct {
+		Project string `cli:"project"`
+	}
+
+	type deployArgs struct {
+		Root rootArgs `cli:"deploy,subcmd"`
+		Src  []string `cli:"src..." minargs:"1"`
+		Dst  string   `cli:"dst"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ deployArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `.TH CMD 1
+.SH NAME
+cmd
+.SH SYNOPSIS
+\fIcmd\fR [<options>] <project> deploy
+.SH DESCRIPTION
+
+.SH OPTIONS
+.TP
+-h, --help
+Display help message and exit.
+`, cmdman.Man(tree, "cmd")["cmd.1"])
+
+	// The sub-command's synopsis includes the parent's arguments, which come
+	// before the sub-command's name.
+	assert.Equal(t, `.TH CMD-DEPLOY 1
+.SH NAME
+cmd-deploy
+.SH SYNOPSIS
+\fIcmd\fR [<options>] <project> \fIdeploy\fR [<options>] <src>... <dst>
+.SH DESCRIPTION
+
+.SH OPTIONS
+.TP
+-h, --help
+Display help message and exit.
+`, cmdman.Man(tree, "cmd")["cmd-deploy.1"])
+}
+
+func TestMan_PersistentFlags(t *testing.T) {
+	type rootArgs struct {
+		Verbose bool `cli:"-v,--verbose" persistent:"true" usage:"be verbose"`
+	}
+
+	type deployArgs struct {
+		Root rootArgs `cli:"deploy,subcmd"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ deployArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `.TH CMD-DEPLOY 1
+.SH NAME
+cmd-deploy
+.SH SYNOPSIS
+\fIcmd\fR [<options>] \fIdeploy\fR [<options>]
+.SH DESCRIPTION
+
+.SH OPTIONS
+.TP
+-h, --help
+Display help message and exit.
+.SH INHERITED OPTIONS
+.TP
+-v, --verbose
+
+`, cmdman.Man(tree, "cmd")["cmd-deploy.1"])
+}
+
+func TestMan_RequiredPersistentFlags(t *testing.T) {
+	type rootArgs struct {
+		Project string `cli:"--project" required:"true" persistent:"true" env:"PROJECT"`
+	}
+
+	type deployArgs struct {
+		Root rootArgs `cli:"deploy,subcmd"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ deployArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `.TH CMD-DEPLOY 1
+.SH NAME
+cmd-deploy
+.SH SYNOPSIS
+\fIcmd\fR [<options>] \fIdeploy\fR [<options>] --project <string>
+.SH DESCRIPTION
+
+.SH OPTIONS
+.TP
+-h, --help
+Display help message and exit.
+.SH INHERITED OPTIONS
+.TP
+--project <string>
+
+.SH ENVIRONMENT
+.TP
+PROJECT
+Used as the value of --project if it is not given.
+`, cmdman.Man(tree, "cmd")["cmd-deploy.1"])
+}
+
 func TestHelp_NonExecutableWithSubcommands(t *testing.T) {
 	tree, err := cmdtree.New([]interface{}{
 		func(_ context.Context, _ sub1Args) error { return nil },
@@ -181,7 +356,7 @@ func TestHelp_NonExecutableWithSubcommands(t *testing.T) {
 .SH NAME
 cmd-sub1
 .SH SYNOPSIS
-\fIcmd sub1\fR [<options>]
+\fIcmd\fR [<options>] \fIsub1\fR [<options>]
 .SH DESCRIPTION
 
 .SH OPTIONS
@@ -193,7 +368,7 @@ Display help message and exit.
 .SH NAME
 cmd-sub2
 .SH SYNOPSIS
-\fIcmd sub2\fR [<options>]
+\fIcmd\fR [<options>] \fIsub2\fR [<options>]
 .SH DESCRIPTION
 
 .SH OPTIONS
@@ -224,3 +399,132 @@ Display help message and exit.
 `,
 	}, cmdman.Man(tree, "./foo/bar/cmd"))
 }
+
+func TestMan_DefaultsAndEnvVars(t *testing.T) {
+	type args struct {
+		Token string `cli:"--token" env:"FOO_TOKEN" default:"xxx"`
+		X     string `cli:"-x" env:"FOO_X"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"cmd.1": `.TH CMD 1
+.SH NAME
+cmd
+.SH SYNOPSIS
+\fIcmd\fR [<options>]
+.SH DESCRIPTION
+
+.SH OPTIONS
+.TP
+--token <string>
+(default: xxx)
+.TP
+-x <string>
+
+.TP
+-h, --help
+Display help message and exit.
+.SH ENVIRONMENT
+.TP
+FOO_TOKEN
+Used as the value of --token if it is not given.
+.TP
+FOO_X
+Used as the value of -x if it is not given.
+`,
+	}, cmdman.Man(tree, "cmd"))
+}
+
+func TestMan_RequiredFlags(t *testing.T) {
+	type args struct {
+		Project string `cli:"-p,--project" value:"name" required:"true"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"cmd.1": `.TH CMD 1
+.SH NAME
+cmd
+.SH SYNOPSIS
+\fIcmd\fR [<options>] --project <name>
+.SH DESCRIPTION
+
+.SH OPTIONS
+.TP
+-p, --project <name>
+
+.TP
+-h, --help
+Display help message and exit.
+`,
+	}, cmdman.Man(tree, "cmd"))
+}
+
+func TestMan_Separator(t *testing.T) {
+	type args struct {
+		Tags []string `cli:"--tags" sep:","`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"cmd.1": `.TH CMD 1
+.SH NAME
+cmd
+.SH SYNOPSIS
+\fIcmd\fR [<options>]
+.SH DESCRIPTION
+
+.SH OPTIONS
+.TP
+--tags <string>[,...]
+
+.TP
+-h, --help
+Display help message and exit.
+`,
+	}, cmdman.Man(tree, "./foo/bar/cmd"))
+}
+
+func TestMan_EnumPosArgs(t *testing.T) {
+	type args struct {
+		Output string   `cli:"output" enum:"json,yaml"`
+		Levels []string `cli:"levels..." enum:"debug,info"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"cmd.1": `.TH CMD 1
+.SH NAME
+cmd
+.SH SYNOPSIS
+\fIcmd\fR [<options>] <json|yaml> [<debug|info>...]
+.SH DESCRIPTION
+
+.SH OPTIONS
+.TP
+-h, --help
+Display help message and exit.
+`,
+	}, cmdman.Man(tree, "./foo/bar/cmd"))
+}
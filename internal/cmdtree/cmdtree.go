@@ -9,6 +9,12 @@ import (
 
 type CommandTree struct {
 	Children map[string]ChildCommand
+
+	// InheritedFlags are the persistent flags of the command's ancestors. Their
+	// FieldIndex is relative to the command's config, by way of its parent
+	// field.
+	InheritedFlags []command.Flag
+
 	command.Command
 }
 
@@ -22,7 +28,30 @@ type cmdWithParentInfo struct {
 	command.ParentInfo
 }
 
+// Options are tree-wide settings that affect how a CommandTree is built.
+type Options struct {
+	// TimeoutFlag adds a --timeout option to every command in the tree.
+	TimeoutFlag bool
+
+	// EnvPrefix, if non-empty, makes every long option in the tree fall back to
+	// an environment variable named after the option, with EnvPrefix and an
+	// underscore in front.
+	EnvPrefix string
+
+	// NegatableBools gives every bool option in the tree that has a long name
+	// a negated form, as if it had a "negatable" tag.
+	NegatableBools bool
+
+	// Abbreviations lets every long option and sub-command name in the tree be
+	// abbreviated to any unambiguous prefix.
+	Abbreviations bool
+}
+
 func New(fns []interface{}) (CommandTree, error) {
+	return NewWithOptions(fns, Options{})
+}
+
+func NewWithOptions(fns []interface{}, opts Options) (CommandTree, error) {
 	cmds := []cmdWithParentInfo{}
 	for _, fn := range fns {
 		cmd, pinfo, err := command.FromFunc(fn)
@@ -68,6 +97,22 @@ func New(fns []interface{}) (CommandTree, error) {
 		}
 	}
 
+	for i := range cmds {
+		if opts.TimeoutFlag {
+			command.AddTimeoutFlag(&cmds[i].Command)
+		}
+
+		if opts.EnvPrefix != "" {
+			command.AddEnvPrefix(&cmds[i].Command, opts.EnvPrefix)
+		}
+
+		if opts.NegatableBools {
+			command.AddNegatableBools(&cmds[i].Command)
+		}
+
+		cmds[i].Abbreviations = opts.Abbreviations
+	}
+
 	cmdsByParent := map[reflect.Type][]cmdWithParentInfo{}
 	for _, cmd := range cmds {
 		cmdsByParent[cmd.ParentType] = append(cmdsByParent[cmd.ParentType], cmd)
@@ -83,43 +128,236 @@ func New(fns []interface{}) (CommandTree, error) {
 		return CommandTree{}, fmt.Errorf("multiple top-level commands: %v", rootTypes)
 	}
 
+	children, err := newForest(cmdsByParent, roots[0].Config)
+	if err != nil {
+		return CommandTree{}, err
+	}
+
 	tree := CommandTree{
 		Command:  roots[0].Command,
-		Children: newForest(cmdsByParent, roots[0].Config),
+		Children: children,
+	}
+
+	if err := addInheritedFlags(&tree); err != nil {
+		return CommandTree{}, err
 	}
 
-	// Do a pass over the tree to make sure no parent command also has
-	// positional arguments; there's no way to disambiguate a positional
-	// argument from a subcommand, so the two must be mutually exclusive.
+	// Do a pass over the tree to make sure parent commands only have a fixed
+	// number of positional arguments. Those arguments come before the
+	// sub-command's name, so there must be no doubt as to how many there are.
 	if err := checkParentCmdPosArgs(tree); err != nil {
 		return CommandTree{}, err
 	}
 
+	if err := checkDefaultSubcommands(tree); err != nil {
+		return CommandTree{}, err
+	}
+
 	return tree, nil
 }
 
-func newForest(cmdsByParent map[reflect.Type][]cmdWithParentInfo, root reflect.Type) map[string]ChildCommand {
+func newForest(cmdsByParent map[reflect.Type][]cmdWithParentInfo, root reflect.Type) (map[string]ChildCommand, error) {
+	if err := checkAliases(cmdsByParent[root]); err != nil {
+		return nil, err
+	}
+
 	out := map[string]ChildCommand{}
 	for _, cmd := range cmdsByParent[root] {
+		children, err := newForest(cmdsByParent, cmd.Config)
+		if err != nil {
+			return nil, err
+		}
+
 		out[cmd.ChildName] = ChildCommand{
 			ParentIndexInChild: cmd.ParentIndexInChild,
 			CommandTree: CommandTree{
 				Command:  cmd.Command,
-				Children: newForest(cmdsByParent, cmd.Config),
+				Children: children,
 			},
 		}
 	}
 
 	if len(out) == 0 {
-		return nil
+		return nil, nil
+	}
+
+	return out, nil
+}
+
+// checkAliases ensures that no alias of a command is the same as the name or
+// another alias of one of its siblings, or of the command itself.
+func checkAliases(siblings []cmdWithParentInfo) error {
+	owners := map[string]string{}
+	for _, cmd := range siblings {
+		owners[cmd.ChildName] = cmd.ChildName
+	}
+
+	for _, cmd := range siblings {
+		for _, alias := range cmd.Aliases {
+			if owner, ok := owners[alias]; ok {
+				return fmt.Errorf("sub-command %s: alias %s conflicts with sub-command %s", cmd.ChildName, alias, owner)
+			}
+
+			owners[alias] = cmd.ChildName
+		}
+	}
+
+	return nil
+}
+
+// addInheritedFlags sets the InheritedFlags of each command below tree. Each
+// command inherits its parent's persistent flags, including the ones the parent
+// itself inherited. The command's own flags may not have the same names as the
+// ones it inherits.
+func addInheritedFlags(tree *CommandTree) error {
+	for name, child := range tree.Children {
+		var inherited []command.Flag
+		for _, f := range tree.AllFlags() {
+			if !f.Persistent {
+				continue
+			}
+
+			f.FieldIndex = append([]int{child.ParentIndexInChild}, f.FieldIndex...)
+			f.ConfigIndex = append([]int{child.ParentIndexInChild}, f.ConfigIndex...)
+			inherited = append(inherited, f)
+		}
+
+		// The special help and timeout options only get the names that a
+		// command doesn't already use, and inherited options count.
+		child.Flags = withoutShadowedBuiltins(child.Flags, inherited)
+
+		for _, f := range child.Flags {
+			for _, g := range inherited {
+				if (f.ShortName != "" && f.ShortName == g.ShortName) || (f.LongName != "" && f.LongName == g.LongName) {
+					return fmt.Errorf("option %s of %v conflicts with persistent option %s", f.DisplayName(), child.Config, g.DisplayName())
+				}
+			}
+		}
+
+		child.InheritedFlags = inherited
+		if err := addInheritedFlags(&child.CommandTree); err != nil {
+			return err
+		}
+
+		tree.Children[name] = child
+	}
+
+	return nil
+}
+
+// withoutShadowedBuiltins returns flags without the names of the special help
+// and timeout options that one of inherited already has. Like for a command's
+// own flags, those options are left out entirely once they have no names left.
+func withoutShadowedBuiltins(flags, inherited []command.Flag) []command.Flag {
+	var out []command.Flag
+	for _, f := range flags {
+		if f.IsHelp || f.IsTimeout {
+			if hasShortName(inherited, f.ShortName) {
+				f.ShortName = ""
+			}
+
+			if hasLongName(inherited, f.LongName) {
+				f.LongName = ""
+			}
+
+			if f.ShortName == "" && f.LongName == "" {
+				continue
+			}
+		}
+
+		out = append(out, f)
 	}
 
 	return out
 }
 
+func hasShortName(flags []command.Flag, name string) bool {
+	for _, f := range flags {
+		if f.ShortName == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasLongName(flags []command.Flag, name string) bool {
+	for _, f := range flags {
+		if f.LongName == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllFlags returns the flags of t, followed by the flags it inherits.
+func (t CommandTree) AllFlags() []command.Flag {
+	return append(append([]command.Flag{}, t.Flags...), t.InheritedFlags...)
+}
+
+// Child returns the child command of t that is invoked as name, which may be
+// either the child's name or one of its aliases. It also returns the child's
+// name, which is the same as name unless name is an alias.
+func (t CommandTree) Child(name string) (string, ChildCommand, bool) {
+	if child, ok := t.Children[name]; ok {
+		return name, child, true
+	}
+
+	for childName, child := range t.Children {
+		for _, alias := range child.Aliases {
+			if alias == name {
+				return childName, child, true
+			}
+		}
+	}
+
+	return "", ChildCommand{}, false
+}
+
+// checkDefaultSubcommands ensures that the default sub-command of each command
+// in tree is one of the command's sub-commands, and that commands with a
+// default sub-command aren't also executable themselves. Otherwise, it would
+// be unclear which of the two to run when no sub-command is given.
+func checkDefaultSubcommands(tree CommandTree) error {
+	if tree.DefaultSubcommand != "" {
+		if _, _, ok := tree.Child(tree.DefaultSubcommand); !ok {
+			return fmt.Errorf("default sub-command %s of %v is not one of its sub-commands", tree.DefaultSubcommand, tree.Config)
+		}
+
+		if tree.Func.IsValid() {
+			return fmt.Errorf("command %v has a default sub-command, and so cannot be executable", tree.Config)
+		}
+	}
+
+	for _, child := range tree.Children {
+		if err := checkDefaultSubcommands(child.CommandTree); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func checkParentCmdPosArgs(tree CommandTree) error {
-	if len(tree.Children) != 0 && len(tree.PosArgs) != 0 {
-		return fmt.Errorf("parent command %v has positional arguments", tree.Config)
+	if len(tree.Children) == 0 {
+		return nil
+	}
+
+	if tree.Trailing.FieldIndex != nil {
+		return fmt.Errorf("parent command %v has trailing arguments", tree.Config)
+	}
+
+	for _, posArg := range tree.PosArgs {
+		if posArg.Optional {
+			return fmt.Errorf("parent command %v has optional positional argument: %s", tree.Config, posArg.Name)
+		}
+	}
+
+	for _, child := range tree.Children {
+		if err := checkParentCmdPosArgs(child.CommandTree); err != nil {
+			return err
+		}
 	}
 
 	return nil
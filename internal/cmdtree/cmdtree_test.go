@@ -71,12 +71,44 @@ func TestNew_PosArgsAndSubcmds(t *testing.T) {
 		Root rootArgs `cli:"root,subcmd"`
 	}
 
-	_, err := cmdtree.New([]interface{}{
+	tree, err := cmdtree.New([]interface{}{
 		func(_ context.Context, _ args) error { return nil },
 	})
 
+	assert.NoError(t, err)
+	assert.Equal(t, "x", tree.PosArgs[0].Name)
+
+	type trailingArgs struct {
+		X []string `cli:"x..."`
+	}
+
+	type subArgs struct {
+		Root trailingArgs `cli:"sub,subcmd"`
+	}
+
+	_, err = cmdtree.New([]interface{}{
+		func(_ context.Context, _ subArgs) error { return nil },
+	})
+
 	assert.Equal(t,
-		"parent command cmdtree_test.rootArgs has positional arguments",
+		"parent command cmdtree_test.trailingArgs has trailing arguments",
+		err.Error())
+
+	type optionalArgs struct {
+		Root rootArgs `cli:"root,subcmd"`
+		Y    *string  `cli:"y"`
+	}
+
+	type nestedArgs struct {
+		Parent optionalArgs `cli:"nested,subcmd"`
+	}
+
+	_, err = cmdtree.New([]interface{}{
+		func(_ context.Context, _ nestedArgs) error { return nil },
+	})
+
+	assert.Equal(t,
+		"parent command cmdtree_test.optionalArgs has optional positional argument: y",
 		err.Error())
 }
 
@@ -319,6 +351,184 @@ func TestNew_MultipleRoots(t *testing.T) {
 		err.Error())
 }
 
+func TestNew_Aliases(t *testing.T) {
+	type rootArgs struct{}
+	type removeArgs struct {
+		Root rootArgs `cli:"remove,subcmd" aliases:"rm,del"`
+	}
+
+	type listArgs struct {
+		Root rootArgs `cli:"list,subcmd" aliases:"ls"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ removeArgs) error { return nil },
+		func(_ context.Context, _ listArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+
+	name, child, ok := tree.Child("del")
+	assert.True(t, ok)
+	assert.Equal(t, "remove", name)
+	assert.Equal(t, []string{"rm", "del"}, child.Aliases)
+
+	name, _, ok = tree.Child("list")
+	assert.True(t, ok)
+	assert.Equal(t, "list", name)
+
+	_, _, ok = tree.Child("xxx")
+	assert.False(t, ok)
+}
+
+func TestNew_AliasConflict(t *testing.T) {
+	type rootArgs struct{}
+	type removeArgs struct {
+		Root rootArgs `cli:"remove,subcmd" aliases:"rm,list"`
+	}
+
+	type listArgs struct {
+		Root rootArgs `cli:"list,subcmd"`
+	}
+
+	_, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ removeArgs) error { return nil },
+		func(_ context.Context, _ listArgs) error { return nil },
+	})
+
+	assert.Equal(t, "sub-command remove: alias list conflicts with sub-command list", err.Error())
+}
+
+type stashArgs struct{}
+
+func (stashArgs) DefaultSubcommand() string {
+	return "push"
+}
+
+func TestNew_DefaultSubcommand(t *testing.T) {
+	type pushArgs struct {
+		Stash stashArgs `cli:"push,subcmd"`
+	}
+
+	type listArgs struct {
+		Stash stashArgs `cli:"list,subcmd"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ pushArgs) error { return nil },
+		func(_ context.Context, _ listArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "push", tree.DefaultSubcommand)
+
+	_, err = cmdtree.New([]interface{}{
+		func(_ context.Context, _ listArgs) error { return nil },
+	})
+
+	assert.Equal(t, "default sub-command push of cmdtree_test.stashArgs is not one of its sub-commands", err.Error())
+
+	_, err = cmdtree.New([]interface{}{
+		func(_ context.Context, _ stashArgs) error { return nil },
+		func(_ context.Context, _ pushArgs) error { return nil },
+	})
+
+	assert.Equal(t, "command cmdtree_test.stashArgs has a default sub-command, and so cannot be executable", err.Error())
+}
+
+func TestNew_PersistentFlags(t *testing.T) {
+	type rootArgs struct {
+		Verbose bool `cli:"-v,--verbose" persistent:"true"`
+		Force   bool `cli:"-f"`
+	}
+
+	type clusterArgs struct {
+		Root    rootArgs `cli:"cluster,subcmd"`
+		Context string   `cli:"--context" persistent:"true"`
+	}
+
+	type nodesArgs struct {
+		Cluster clusterArgs `cli:"nodes,subcmd"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ nodesArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+
+	cluster := tree.Children["cluster"]
+	assert.Equal(t, 1, len(cluster.InheritedFlags))
+	assert.Equal(t, "verbose", cluster.InheritedFlags[0].LongName)
+	assert.Equal(t, []int{0, 0}, cluster.InheritedFlags[0].FieldIndex)
+	assert.Equal(t, []int{0}, cluster.InheritedFlags[0].ConfigIndex)
+
+	nodes := cluster.Children["nodes"]
+	assert.Equal(t, 2, len(nodes.InheritedFlags))
+	assert.Equal(t, "context", nodes.InheritedFlags[0].LongName)
+	assert.Equal(t, []int{0, 1}, nodes.InheritedFlags[0].FieldIndex)
+	assert.Equal(t, "verbose", nodes.InheritedFlags[1].LongName)
+	assert.Equal(t, []int{0, 0, 0}, nodes.InheritedFlags[1].FieldIndex)
+	assert.Equal(t, []int{0, 0}, nodes.InheritedFlags[1].ConfigIndex)
+
+	type conflictArgs struct {
+		Root    rootArgs `cli:"conflict,subcmd"`
+		Verbose int      `cli:"-v"`
+	}
+
+	_, err = cmdtree.New([]interface{}{
+		func(_ context.Context, _ conflictArgs) error { return nil },
+	})
+
+	assert.Equal(t, "option -v of cmdtree_test.conflictArgs conflicts with persistent option --verbose", err.Error())
+}
+
+func TestNew_PersistentTimeoutFlag(t *testing.T) {
+	type rootArgs struct {
+		Timeout string `cli:"--timeout" persistent:"true"`
+	}
+
+	type subArgs struct {
+		Root rootArgs `cli:"sub,subcmd"`
+	}
+
+	tree, err := cmdtree.NewWithOptions([]interface{}{
+		func(_ context.Context, _ subArgs) error { return nil },
+	}, cmdtree.Options{TimeoutFlag: true})
+
+	assert.NoError(t, err)
+
+	sub := tree.Children["sub"]
+	for _, f := range sub.Flags {
+		assert.False(t, f.IsTimeout)
+	}
+
+	assert.Equal(t, "timeout", sub.InheritedFlags[0].LongName)
+	assert.False(t, sub.InheritedFlags[0].IsTimeout)
+}
+
+func TestNew_PersistentHelpShortName(t *testing.T) {
+	type rootArgs struct {
+		Host string `cli:"-h,--host" persistent:"true"`
+	}
+
+	type subArgs struct {
+		Root rootArgs `cli:"sub,subcmd"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ subArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+
+	sub := tree.Children["sub"]
+	assert.Equal(t, []command.Flag{
+		{IsHelp: true, LongName: "help", Usage: "display this help and exit", ExtendedUsage: "Display help message and exit."},
+	}, sub.Flags)
+	assert.Equal(t, "h", sub.InheritedFlags[0].ShortName)
+}
+
 func removeFunc(tree cmdtree.CommandTree) cmdtree.CommandTree {
 	tree.Command.Func = reflect.Value{}
 	for k, v := range tree.Children {
@@ -328,3 +538,17 @@ func removeFunc(tree cmdtree.CommandTree) cmdtree.CommandTree {
 
 	return tree
 }
+
+func TestNew_BadDefault(t *testing.T) {
+	type args struct {
+		X int `cli:"--x" default:"xxx"`
+	}
+
+	_, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error { return nil },
+	})
+
+	assert.Equal(t,
+		"X: invalid default value: \"xxx\": strconv.ParseInt: parsing \"xxx\": invalid syntax",
+		err.Error())
+}
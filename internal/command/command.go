@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/ucarion/cli/internal/param"
 	"github.com/ucarion/cli/internal/tagparse"
@@ -17,6 +18,24 @@ type Command struct {
 	Flags               []Flag
 	PosArgs             []PosArg
 	Trailing            PosArg
+	ValidateFunc        reflect.Value
+
+	// AfterTrailing are the posargs declared after Trailing. They take the
+	// last values in args, and Trailing takes the ones before them.
+	AfterTrailing []PosArg
+
+	// Aliases are other names the command can be invoked by, as a
+	// sub-command. If HideAliases is true, they aren't autocompleted.
+	Aliases     []string
+	HideAliases bool
+
+	// Abbreviations is whether the command's long options and sub-command
+	// names may be abbreviated to any unambiguous prefix.
+	Abbreviations bool
+
+	// DefaultSubcommand is the name of the sub-command that is run when the
+	// command is invoked without the name of one of its sub-commands.
+	DefaultSubcommand string
 }
 
 type Flag struct {
@@ -25,15 +44,57 @@ type Flag struct {
 	Usage            string
 	ExtendedUsage    string
 	ValueName        string
+	EnvVar           string
+	Default          string
+	Required         bool
+	Enum             []string
+	Exclusive        []string
+	AnyOf            []string
+	Requires         []string
+	Negatable        bool
+	Persistent       bool
+	ParamOptions     param.Options
 	IsHelp           bool
+	IsTimeout        bool
 	FieldIndex       []int
 	AutocompleteFunc reflect.Value
+
+	// AutocompleteKeyFunc and AutocompleteValueFunc complete the keys and
+	// values of map-typed flags, respectively. AutocompleteValueFunc takes the
+	// key whose value is being completed.
+	AutocompleteKeyFunc   reflect.Value
+	AutocompleteValueFunc reflect.Value
+
+	// ConfigIndex is the index of the field that holds the config that
+	// FieldIndex was originally relative to, and that the autocomplete funcs
+	// take. It's only set on persistent flags inherited from an ancestor
+	// command, whose FieldIndex goes through the parent fields.
+	ConfigIndex []int
 }
 
 type PosArg struct {
 	Name             string
+	Enum             []string
+	ParamOptions     param.Options
 	FieldIndex       []int
 	AutocompleteFunc reflect.Value
+
+	// Optional is whether a non-trailing argument may be left out. That's the
+	// case for pointer-typed arguments that aren't followed by any required
+	// ones.
+	Optional bool
+
+	// MinArgs and MaxArgs bound how many values trailing arguments take.
+	// MaxArgs is zero if there's no upper bound.
+	MinArgs int
+	MaxArgs int
+}
+
+// FlagGroup is a named set of flags that are constrained together, such as
+// flags that are mutually exclusive.
+type FlagGroup struct {
+	Name  string
+	Flags []Flag
 }
 
 type ParentInfo struct {
@@ -50,12 +111,32 @@ type extendedDescription interface {
 	ExtendedDescription() string
 }
 
+type defaultSubcommand interface {
+	DefaultSubcommand() string
+}
+
+type validator interface {
+	Validate() error
+}
+
+type enum interface {
+	Enum() []string
+}
+
 const (
-	extendedUsagePrefix = "ExtendedUsage_"
-	autocompletePrefix  = "Autocomplete_"
+	extendedUsagePrefix     = "ExtendedUsage_"
+	autocompletePrefix      = "Autocomplete_"
+	autocompleteKeyPrefix   = "AutocompleteKey_"
+	autocompleteValuePrefix = "AutocompleteValue_"
 )
 
 func FromFunc(fn interface{}) (Command, ParentInfo, error) {
+	// Constructors of command funcs, such as flagset.New, return an error in
+	// place of the func if they fail.
+	if err, ok := fn.(error); ok {
+		return Command{}, ParentInfo{}, err
+	}
+
 	t := reflect.TypeOf(fn)
 
 	if err := checkValidFunc(t); err != nil {
@@ -126,6 +207,9 @@ func FromType(t reflect.Type) (Command, ParentInfo, error) {
 				ParentType:         f.Type,
 				ParentIndexInChild: i,
 			}
+
+			cmd.Aliases = tag.Aliases
+			cmd.HideAliases = tag.HideAliases
 		}
 	}
 
@@ -139,10 +223,36 @@ func FromType(t reflect.Type) (Command, ParentInfo, error) {
 		cmd.ExtendedDescription = v.ExtendedDescription()
 	}
 
+	if v, ok := v.(defaultSubcommand); ok {
+		cmd.DefaultSubcommand = v.DefaultSubcommand()
+	}
+
+	// Validate is called later, on the parsed config, so we just hold on to the
+	// method for now. The method is taken from the pointer type so that it can
+	// have either a value or pointer receiver.
+	if _, ok := v.(validator); ok {
+		m, _ := reflect.PtrTo(t).MethodByName("Validate")
+		cmd.ValidateFunc = m.Func
+	}
+
 	if err := addParams(&cmd, nil, t); err != nil {
 		return Command{}, ParentInfo{}, err
 	}
 
+	if err := checkFlagGroups(&cmd); err != nil {
+		return Command{}, ParentInfo{}, err
+	}
+
+	markOptionalPosArgs(&cmd)
+
+	for _, f := range cmd.Flags {
+		if f.Negatable {
+			if _, ok := cmd.flagByName("--" + NegatedPrefix + f.LongName); ok {
+				return Command{}, ParentInfo{}, fmt.Errorf("--%s: negated form conflicts with existing option", f.LongName)
+			}
+		}
+	}
+
 	addHelpFlag(&cmd)
 
 	return cmd, pinfo, nil
@@ -168,10 +278,51 @@ func addParams(cmd *Command, index []int, t reflect.Type) error {
 		switch tag.Kind {
 		case tagparse.KindFlag:
 			// Ensure the field is a valid param.
-			if _, err := param.New(reflect.New(f.Type).Interface()); err != nil {
+			paramOptions := param.Options{
+				Counter:    tag.Counter,
+				UniqueKeys: tag.UniqueKeys,
+				Separator:  tag.Separator,
+				Layout:     tag.Layout,
+
+				DefaultPort: tag.DefaultPort,
+				Schemes:     tag.Schemes,
+				Format:      tag.Format,
+			}
+
+			p, err := param.NewWithOptions(reflect.New(f.Type).Interface(), paramOptions)
+			if err != nil {
 				return fmt.Errorf("%v: %w", f.Name, err)
 			}
 
+			if tag.Negatable && !param.IsBool(p) {
+				return fmt.Errorf("%v: negatable tag can only be used on bool options", f.Name)
+			}
+
+			// A default would make a required option always be given.
+			if tag.Required && tag.Default != "" {
+				return fmt.Errorf("%v: required options cannot have a default value", f.Name)
+			}
+
+			enum := enumValues(tag, f.Type)
+
+			// Ensure the default value, if any, is valid for the param.
+			if tag.Default != "" {
+				defaults := []string{tag.Default}
+				if tag.Separator != "" {
+					defaults = param.SplitEscaped(tag.Default, tag.Separator)
+				}
+
+				for _, d := range defaults {
+					if len(enum) != 0 && !contains(enum, d) {
+						return fmt.Errorf("%v: invalid default value: %q: must be one of: %s", f.Name, tag.Default, strings.Join(enum, ", "))
+					}
+				}
+
+				if err := p.UnmarshalText([]byte(tag.Default)); err != nil {
+					return fmt.Errorf("%v: invalid default value: %q: %w", f.Name, tag.Default, err)
+				}
+			}
+
 			var extendedUsage string
 			if m, ok := t.MethodByName(extendedUsagePrefix + f.Name); ok {
 				// Ensure the method has the right signature: it takes in a
@@ -191,18 +342,55 @@ func addParams(cmd *Command, index []int, t reflect.Type) error {
 				}
 			}
 
+			var autocompleteKeyFunc reflect.Value
+			if m, ok := t.MethodByName(autocompleteKeyPrefix + f.Name); ok {
+				// Ensure the method has the right signature: it takes in a
+				// receiver and no args, and returns just a []string.
+				if m.Type.NumIn() == 1 && m.Type.NumOut() == 1 && m.Type.Out(0) == stringSliceType {
+					autocompleteKeyFunc = m.Func
+				}
+			}
+
+			var autocompleteValueFunc reflect.Value
+			if m, ok := t.MethodByName(autocompleteValuePrefix + f.Name); ok {
+				// Ensure the method has the right signature: it takes in a
+				// receiver and a string key, and returns just a []string.
+				if m.Type.NumIn() == 2 && m.Type.In(1) == stringType && m.Type.NumOut() == 1 && m.Type.Out(0) == stringSliceType {
+					autocompleteValueFunc = m.Func
+				}
+			}
+
 			cmd.Flags = append(cmd.Flags, Flag{
 				ShortName:        tag.ShortFlagName,
 				LongName:         tag.LongFlagName,
 				Usage:            tag.Usage,
 				ExtendedUsage:    extendedUsage,
 				ValueName:        tag.FlagValueName,
+				EnvVar:           tag.EnvVar,
+				Default:          tag.Default,
+				Required:         tag.Required,
+				Enum:             enum,
+				Exclusive:        tag.Exclusive,
+				AnyOf:            tag.AnyOf,
+				Requires:         tag.Requires,
+				Negatable:        tag.Negatable,
+				Persistent:       tag.Persistent,
+				ParamOptions:     paramOptions,
 				FieldIndex:       append(index, i),
 				AutocompleteFunc: autocompleteFunc,
+
+				AutocompleteKeyFunc:   autocompleteKeyFunc,
+				AutocompleteValueFunc: autocompleteValueFunc,
 			})
 		case tagparse.KindPosArg:
 			// Ensure the field is a valid param.
-			if _, err := param.New(reflect.New(f.Type).Interface()); err != nil {
+			paramOptions := param.Options{
+				Layout:      tag.Layout,
+				DefaultPort: tag.DefaultPort,
+				Schemes:     tag.Schemes,
+				Format:      tag.Format,
+			}
+			if _, err := param.NewWithOptions(reflect.New(f.Type).Interface(), paramOptions); err != nil {
 				return fmt.Errorf("%v: %w", f.Name, err)
 			}
 
@@ -217,13 +405,20 @@ func addParams(cmd *Command, index []int, t reflect.Type) error {
 
 			posArg := PosArg{
 				Name:             tag.PosArgName,
+				Enum:             enumValues(tag, f.Type),
+				ParamOptions:     paramOptions,
 				FieldIndex:       append(index, i),
 				AutocompleteFunc: autocompleteFunc,
+				MinArgs:          tag.MinArgs,
+				MaxArgs:          tag.MaxArgs,
 			}
 
-			if tag.IsTrailing {
+			switch {
+			case tag.IsTrailing:
 				cmd.Trailing = posArg
-			} else {
+			case cmd.Trailing.FieldIndex != nil:
+				cmd.AfterTrailing = append(cmd.AfterTrailing, posArg)
+			default:
 				cmd.PosArgs = append(cmd.PosArgs, posArg)
 			}
 		}
@@ -232,6 +427,123 @@ func addParams(cmd *Command, index []int, t reflect.Type) error {
 	return nil
 }
 
+// markOptionalPosArgs marks the pointer-typed posargs at the end of cmd's
+// non-trailing posargs as optional. Pointer-typed posargs that come before a
+// required one are still required, since leaving them out would be ambiguous.
+// That includes trailing posargs that require values, and the posargs after
+// the trailing ones.
+func markOptionalPosArgs(cmd *Command) {
+	if cmd.Trailing.MinArgs > 0 || len(cmd.AfterTrailing) != 0 {
+		return
+	}
+
+	for i := len(cmd.PosArgs) - 1; i >= 0; i-- {
+		v := reflect.New(cmd.Config.FieldByIndex(cmd.PosArgs[i].FieldIndex).Type).Interface()
+		p, _ := param.NewWithOptions(v, cmd.PosArgs[i].ParamOptions)
+		if !param.IsPointer(p) {
+			return
+		}
+
+		cmd.PosArgs[i].Optional = true
+	}
+}
+
+// checkFlagGroups ensures that the flag constraints of cmd are sensible. It
+// also rewrites the flag names in requires tags to their display names, so that
+// "-k" and "--key" are treated alike.
+func checkFlagGroups(cmd *Command) error {
+	for i, f := range cmd.Flags {
+		for j, name := range f.Requires {
+			other, ok := cmd.flagByName(name)
+			if !ok {
+				return fmt.Errorf("%s: requires unknown option: %s", f.DisplayName(), name)
+			}
+
+			cmd.Flags[i].Requires[j] = other.DisplayName()
+		}
+	}
+
+	for _, g := range cmd.ExclusiveGroups() {
+		if len(g.Flags) < 2 {
+			return fmt.Errorf("exclusive group %s must have more than one option", g.Name)
+		}
+	}
+
+	return nil
+}
+
+func (c Command) flagByName(name string) (Flag, bool) {
+	for _, f := range c.Flags {
+		if (f.ShortName != "" && name == "-"+f.ShortName) || (f.LongName != "" && name == "--"+f.LongName) {
+			return f, true
+		}
+	}
+
+	return Flag{}, false
+}
+
+// ExclusiveGroups returns the groups of flags in c that cannot be used
+// together, in the order in which they're first mentioned.
+func (c Command) ExclusiveGroups() []FlagGroup {
+	return groupFlags(c.Flags, func(f Flag) []string { return f.Exclusive })
+}
+
+// AnyOfGroups returns the groups of flags in c of which at least one must be
+// used, in the order in which they're first mentioned.
+func (c Command) AnyOfGroups() []FlagGroup {
+	return groupFlags(c.Flags, func(f Flag) []string { return f.AnyOf })
+}
+
+func groupFlags(flags []Flag, groupNames func(Flag) []string) []FlagGroup {
+	var out []FlagGroup
+	indices := map[string]int{}
+
+	for _, f := range flags {
+		for _, name := range groupNames(f) {
+			i, ok := indices[name]
+			if !ok {
+				i = len(out)
+				indices[name] = i
+				out = append(out, FlagGroup{Name: name})
+			}
+
+			out[i].Flags = append(out[i].Flags, f)
+		}
+	}
+
+	return out
+}
+
+// enumValues returns the set of values a param of type t is restricted to, or
+// nil if the param isn't restricted. The enum tag takes precedence over param
+// types that implement the enum interface.
+func enumValues(tag tagparse.ParsedTag, t reflect.Type) []string {
+	if tag.Enum != nil {
+		return tag.Enum
+	}
+
+	// For slices and pointers, it's the underlying type that matters.
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if v, ok := reflect.New(t).Interface().(enum); ok {
+		return v.Enum()
+	}
+
+	return nil
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
 const (
 	shortHelp         = "h"
 	longHelp          = "help"
@@ -264,3 +576,85 @@ func addHelpFlag(cmd *Command) {
 
 	cmd.Flags = append(cmd.Flags, helpFlag)
 }
+
+// DisplayName returns the name of f as a user would type it, preferring the
+// long name, e.g. "--force" or "-f".
+func (f Flag) DisplayName() string {
+	if f.LongName != "" {
+		return "--" + f.LongName
+	}
+
+	return "-" + f.ShortName
+}
+
+// AddEnvPrefix gives every option in cmd that has a long name, but no explicit
+// environment variable, an environment variable derived from prefix and the
+// long name. For instance, with the prefix "MYTOOL", "--dry-run" is read from
+// "MYTOOL_DRY_RUN".
+func AddEnvPrefix(cmd *Command, prefix string) {
+	for i, f := range cmd.Flags {
+		if f.IsHelp || f.IsTimeout || f.EnvVar != "" || f.LongName == "" {
+			continue
+		}
+
+		name := strings.ToUpper(strings.ReplaceAll(f.LongName, "-", "_"))
+		cmd.Flags[i].EnvVar = prefix + "_" + name
+	}
+}
+
+// NegatedPrefix is what comes between the dashes and the name of a negatable
+// option in its negated form, as in "--no-color".
+const NegatedPrefix = "no-"
+
+// AddNegatableBools makes every bool option in cmd that has a long name
+// negatable, unless the negated form of its name is already taken.
+func AddNegatableBools(cmd *Command) {
+	config := reflect.New(cmd.Config).Elem()
+	for i, f := range cmd.Flags {
+		if f.IsHelp || f.IsTimeout || f.LongName == "" {
+			continue
+		}
+
+		if _, ok := cmd.flagByName("--" + NegatedPrefix + f.LongName); ok {
+			continue
+		}
+
+		p, _ := param.NewWithOptions(config.FieldByIndex(f.FieldIndex).Addr().Interface(), f.ParamOptions)
+		if param.IsBool(p) {
+			cmd.Flags[i].Negatable = true
+		}
+	}
+}
+
+const (
+	longTimeout          = "timeout"
+	timeoutValueName     = "duration"
+	timeoutUsage         = "cancel the command after the given duration"
+	timeoutExtendedUsage = "Cancel the command if it has not completed after the given duration, such as 30s or 5m."
+)
+
+// AddTimeoutFlag adds a special timeout option to cmd, unless cmd already has an
+// option with the same name. The timeout option is placed before the help
+// option, if there is one.
+func AddTimeoutFlag(cmd *Command) {
+	for _, f := range cmd.Flags {
+		if f.LongName == longTimeout {
+			return
+		}
+	}
+
+	timeoutFlag := Flag{
+		IsTimeout:     true,
+		LongName:      longTimeout,
+		Usage:         timeoutUsage,
+		ExtendedUsage: timeoutExtendedUsage,
+		ValueName:     timeoutValueName,
+	}
+
+	i := len(cmd.Flags)
+	if i > 0 && cmd.Flags[i-1].IsHelp {
+		i--
+	}
+
+	cmd.Flags = append(cmd.Flags[:i], append([]Flag{timeoutFlag}, cmd.Flags[i:]...)...)
+}
@@ -226,10 +226,12 @@ func TestFromType_PosArgs(t *testing.T) {
 		Config: reflect.TypeOf(args{}),
 		PosArgs: []command.PosArg{
 			command.PosArg{Name: "a", FieldIndex: []int{0}},
-			command.PosArg{Name: "d", FieldIndex: []int{3}},
 		},
 		Flags:    []command.Flag{helpFlag},
 		Trailing: command.PosArg{Name: "b", FieldIndex: []int{1}},
+		AfterTrailing: []command.PosArg{
+			command.PosArg{Name: "d", FieldIndex: []int{3}},
+		},
 	}, cmd)
 	assert.Equal(t, command.ParentInfo{}, pinfo)
 }
@@ -262,10 +264,12 @@ func TestFromType_EmbeddedPosArgs(t *testing.T) {
 			command.PosArg{Name: "b", FieldIndex: []int{1}},
 			command.PosArg{Name: "d", FieldIndex: []int{3}},
 			command.PosArg{Name: "e", FieldIndex: []int{4, 0}},
-			command.PosArg{Name: "g", FieldIndex: []int{4, 2}},
 		},
 		Flags:    []command.Flag{helpFlag},
 		Trailing: command.PosArg{Name: "f", FieldIndex: []int{4, 1, 0}},
+		AfterTrailing: []command.PosArg{
+			command.PosArg{Name: "g", FieldIndex: []int{4, 2}},
+		},
 	}, cmd)
 	assert.Equal(t, command.ParentInfo{}, pinfo)
 }
@@ -320,6 +324,28 @@ func TestFromType_UsageAndValueTag(t *testing.T) {
 	assert.Equal(t, command.ParentInfo{}, pinfo)
 }
 
+func TestFromType_DefaultTag(t *testing.T) {
+	type args struct {
+		A int `cli:"-a" default:"3"`
+	}
+
+	cmd, _, err := command.FromType(reflect.TypeOf(args{}))
+	assert.NoError(t, err)
+	assert.Equal(t, []command.Flag{
+		command.Flag{ShortName: "a", Default: "3", FieldIndex: []int{0}},
+		helpFlag,
+	}, cmd.Flags)
+}
+
+func TestFromType_RequiredWithDefault(t *testing.T) {
+	type args struct {
+		A int `cli:"-a" required:"true" default:"3"`
+	}
+
+	_, _, err := command.FromType(reflect.TypeOf(args{}))
+	assert.EqualError(t, err, "A: required options cannot have a default value")
+}
+
 type argsWithMethods struct {
 	A string `cli:"-a"`
 	B string `cli:"-b"`
@@ -375,6 +401,22 @@ func TestFromType_Methods(t *testing.T) {
 	assert.Equal(t, []string{"toto"}, f2(argsWithMethods{}))
 }
 
+type argsWithValidate struct{}
+
+func (a *argsWithValidate) Validate() error {
+	return nil
+}
+
+func TestFromType_Validate(t *testing.T) {
+	cmd, _, err := command.FromType(reflect.TypeOf(argsWithValidate{}))
+	assert.NoError(t, err)
+	assert.True(t, cmd.ValidateFunc.IsValid())
+
+	cmd, _, err = command.FromType(reflect.TypeOf(argsWithMethods{}))
+	assert.NoError(t, err)
+	assert.False(t, cmd.ValidateFunc.IsValid())
+}
+
 func TestFromType_BadTag(t *testing.T) {
 	type args struct {
 		X string `cli:"_"`
@@ -526,3 +568,189 @@ func TestFromType_BadEmbedType(t *testing.T) {
 		"X: unsupported pointer param type: unsupported param type: *string",
 		err.Error())
 }
+
+func TestAddTimeoutFlag(t *testing.T) {
+	type args struct {
+		X string `cli:"-x"`
+	}
+
+	cmd, _, err := command.FromType(reflect.TypeOf(args{}))
+	assert.NoError(t, err)
+
+	command.AddTimeoutFlag(&cmd)
+	assert.Equal(t, []command.Flag{
+		command.Flag{ShortName: "x", FieldIndex: []int{0}},
+		command.Flag{
+			IsTimeout:     true,
+			LongName:      "timeout",
+			Usage:         "cancel the command after the given duration",
+			ExtendedUsage: "Cancel the command if it has not completed after the given duration, such as 30s or 5m.",
+			ValueName:     "duration",
+		},
+		helpFlag,
+	}, cmd.Flags)
+}
+
+func TestAddTimeoutFlag_Existing(t *testing.T) {
+	type args struct {
+		Timeout string `cli:"--timeout"`
+	}
+
+	cmd, _, err := command.FromType(reflect.TypeOf(args{}))
+	assert.NoError(t, err)
+
+	command.AddTimeoutFlag(&cmd)
+	assert.Equal(t, []command.Flag{
+		command.Flag{LongName: "timeout", FieldIndex: []int{0}},
+		helpFlag,
+	}, cmd.Flags)
+}
+
+func TestAddEnvPrefix(t *testing.T) {
+	type args struct {
+		A string `cli:"-a"`
+		B string `cli:"--bravo-charlie"`
+		C string `cli:"--charlie" env:"XXX"`
+	}
+
+	cmd, _, err := command.FromType(reflect.TypeOf(args{}))
+	assert.NoError(t, err)
+
+	command.AddEnvPrefix(&cmd, "FOO")
+	assert.Equal(t, []command.Flag{
+		command.Flag{ShortName: "a", FieldIndex: []int{0}},
+		command.Flag{LongName: "bravo-charlie", EnvVar: "FOO_BRAVO_CHARLIE", FieldIndex: []int{1}},
+		command.Flag{LongName: "charlie", EnvVar: "XXX", FieldIndex: []int{2}},
+		helpFlag,
+	}, cmd.Flags)
+}
+
+type color string
+
+func (c *color) UnmarshalText(b []byte) error {
+	*c = color(b)
+	return nil
+}
+
+func (c color) Enum() []string {
+	return []string{"red", "green", "blue"}
+}
+
+func TestFromType_Enum(t *testing.T) {
+	type args struct {
+		A string  `cli:"-a" enum:"x,y"`
+		B color   `cli:"-b"`
+		C []color `cli:"-c"`
+		D color   `cli:"-d" enum:"red"`
+		E color   `cli:"e"`
+	}
+
+	cmd, _, err := command.FromType(reflect.TypeOf(args{}))
+	assert.NoError(t, err)
+	assert.Equal(t, []command.Flag{
+		command.Flag{ShortName: "a", Enum: []string{"x", "y"}, FieldIndex: []int{0}},
+		command.Flag{ShortName: "b", Enum: []string{"red", "green", "blue"}, FieldIndex: []int{1}},
+		command.Flag{ShortName: "c", Enum: []string{"red", "green", "blue"}, FieldIndex: []int{2}},
+		command.Flag{ShortName: "d", Enum: []string{"red"}, FieldIndex: []int{3}},
+		helpFlag,
+	}, cmd.Flags)
+	assert.Equal(t, []command.PosArg{
+		command.PosArg{Name: "e", Enum: []string{"red", "green", "blue"}, FieldIndex: []int{4}},
+	}, cmd.PosArgs)
+}
+
+func TestFromType_BadEnumDefault(t *testing.T) {
+	type args struct {
+		A string `cli:"-a" enum:"x,y" default:"z"`
+	}
+
+	_, _, err := command.FromType(reflect.TypeOf(args{}))
+	assert.EqualError(t, err, "A: invalid default value: \"z\": must be one of: x, y")
+}
+
+func TestFromType_FlagGroups(t *testing.T) {
+	type args struct {
+		JSON  bool   `cli:"--json" exclusive:"output"`
+		Table bool   `cli:"--table" exclusive:"output"`
+		Cert  string `cli:"--cert" requires:"-k"`
+		Key   string `cli:"-k,--key"`
+		Token string `cli:"--token" anyof:"auth"`
+	}
+
+	cmd, _, err := command.FromType(reflect.TypeOf(args{}))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"--key"}, cmd.Flags[2].Requires)
+	assert.Equal(t, []command.FlagGroup{
+		{Name: "output", Flags: cmd.Flags[0:2]},
+	}, cmd.ExclusiveGroups())
+	assert.Equal(t, []command.FlagGroup{
+		{Name: "auth", Flags: cmd.Flags[4:5]},
+	}, cmd.AnyOfGroups())
+}
+
+func TestFromType_BadFlagGroups(t *testing.T) {
+	type args1 struct {
+		Cert string `cli:"--cert" requires:"--key"`
+	}
+
+	_, _, err := command.FromType(reflect.TypeOf(args1{}))
+	assert.EqualError(t, err, "--cert: requires unknown option: --key")
+
+	type args2 struct {
+		JSON bool `cli:"--json" exclusive:"output"`
+	}
+
+	_, _, err = command.FromType(reflect.TypeOf(args2{}))
+	assert.EqualError(t, err, "exclusive group output must have more than one option")
+}
+
+func TestFromType_Negatable(t *testing.T) {
+	type args1 struct {
+		A string `cli:"--a" negatable:"true"`
+	}
+
+	_, _, err := command.FromType(reflect.TypeOf(args1{}))
+	assert.EqualError(t, err, "A: negatable tag can only be used on bool options")
+
+	type args2 struct {
+		A bool `cli:"--a" negatable:"true"`
+		B bool `cli:"--no-a"`
+	}
+
+	_, _, err = command.FromType(reflect.TypeOf(args2{}))
+	assert.EqualError(t, err, "--a: negated form conflicts with existing option")
+}
+
+func TestAddNegatableBools(t *testing.T) {
+	type args struct {
+		A bool   `cli:"--a"`
+		B *bool  `cli:"--b"`
+		C string `cli:"--c"`
+		D bool   `cli:"-d"`
+		E bool   `cli:"--e"`
+		F bool   `cli:"--no-e"`
+	}
+
+	cmd, _, err := command.FromType(reflect.TypeOf(args{}))
+	assert.NoError(t, err)
+
+	command.AddNegatableBools(&cmd)
+
+	var negatable []string
+	for _, f := range cmd.Flags {
+		if f.Negatable {
+			negatable = append(negatable, f.DisplayName())
+		}
+	}
+
+	assert.Equal(t, []string{"--a", "--b", "--no-e"}, negatable)
+}
+
+func TestFromType_UniqueKeysOnNonMap(t *testing.T) {
+	type args struct {
+		X string `cli:"-x" uniquekeys:"true"`
+	}
+
+	_, _, err := command.FromType(reflect.TypeOf(args{}))
+	assert.EqualError(t, err, "X: unique keys are only supported for maps, got: string")
+}
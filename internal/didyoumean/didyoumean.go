@@ -1,17 +1,35 @@
 package didyoumean
 
 import (
+	"sort"
+
 	"github.com/ucarion/cli/internal/cmdtree"
 )
 
 func DidYouMean(tree cmdtree.CommandTree, s string) string {
+	keys := []string{}
+	for key, child := range tree.Children {
+		keys = append(keys, key)
+
+		if !child.HideAliases {
+			keys = append(keys, child.Aliases...)
+		}
+	}
+
+	sort.Strings(keys)
+	return Closest(s, keys)
+}
+
+// Closest returns the element of candidates that is closest to s. Ties go to
+// the earliest candidate.
+func Closest(s string, candidates []string) string {
 	var out string
 	var best int
 
-	for key := range tree.Children {
-		d := distance(s, key)
-		if best == 0 || d < best {
-			out = key
+	for i, c := range candidates {
+		d := distance(s, c)
+		if i == 0 || d < best {
+			out = c
 			best = d
 		}
 	}
@@ -38,3 +38,31 @@ func TestDidYouMean(t *testing.T) {
 	assert.Equal(t, "bbb", didyoumean.DidYouMean(tree, "bbz"))
 	assert.Equal(t, "ccc", didyoumean.DidYouMean(tree, "cc"))
 }
+
+func TestDidYouMean_Aliases(t *testing.T) {
+	type rootArgs struct{}
+
+	type removeArgs struct {
+		Root rootArgs `cli:"remove,subcmd" aliases:"rm"`
+	}
+
+	type listArgs struct {
+		Root rootArgs `cli:"list,subcmd" aliases:"ls" hidealiases:"true"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ removeArgs) error { return nil },
+		func(_ context.Context, _ listArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "rm", didyoumean.DidYouMean(tree, "rn"))
+	assert.Equal(t, "list", didyoumean.DidYouMean(tree, "lss"))
+}
+
+func TestClosest(t *testing.T) {
+	assert.Equal(t, "", didyoumean.Closest("xxx", nil))
+	assert.Equal(t, "json", didyoumean.Closest("jsn", []string{"json", "yaml", "table"}))
+	assert.Equal(t, "yaml", didyoumean.Closest("yml", []string{"json", "yaml", "table"}))
+	assert.Equal(t, "aa", didyoumean.Closest("a", []string{"aa", "ab"}))
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"os"
 	"reflect"
 	"strings"
 
@@ -13,15 +12,56 @@ import (
 	"github.com/ucarion/cli/internal/cmdtree"
 )
 
-var HelpWriter io.Writer = os.Stdout
+// ExitCodeUsage is the exit code conventionally used by Unix tools when they
+// are invoked incorrectly.
+const ExitCodeUsage = 2
 
-func Exec(ctx context.Context, tree cmdtree.CommandTree, args []string) error {
+// UsageError is returned by Exec when args are not a valid invocation of the
+// command tree, as opposed to when the invoked command itself fails.
+type UsageError struct {
+	Err error
+
+	// Usage, if non-empty, is the usage line of the command that was invoked
+	// incorrectly. It is included in the error's message, after Err.
+	Usage string
+}
+
+func (e UsageError) Error() string {
+	if e.Usage != "" {
+		return fmt.Sprintf("%s\n%s", e.Err.Error(), e.Usage)
+	}
+
+	return e.Err.Error()
+}
+
+func (e UsageError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns ExitCodeUsage.
+func (e UsageError) ExitCode() int {
+	return ExitCodeUsage
+}
+
+// Exec parses args against tree, and then calls the appropriate function in the
+// tree. If the args call for a help message instead, the help message is
+// written to w. Options that fall back to environment variables are looked up
+// with lookupEnv, which may be nil.
+func Exec(ctx context.Context, w io.Writer, tree cmdtree.CommandTree, args []string, lookupEnv func(string) (string, bool)) error {
 	// The argparser module does most of the work of understanding what each arg
 	// does to the tree.
-	parser := argparser.New(tree)
+	parser := argparser.New(tree, lookupEnv)
 	for _, arg := range args {
 		if err := parser.ParseArg(arg); err != nil {
-			return err
+			return UsageError{Err: err}
+		}
+	}
+
+	// If args end at a command with a default sub-command, then the default
+	// sub-command is the one being invoked.
+	if !parser.ShowHelp && !parser.ExpectingValue() {
+		if err := parser.EnterDefaultSubcommand(); err != nil {
+			return UsageError{Err: err}
 		}
 	}
 
@@ -31,14 +71,33 @@ func Exec(ctx context.Context, tree cmdtree.CommandTree, args []string) error {
 	// We do this check before the NoMoreArgs check because we want to let users
 	// pass --help without necessarily making a correct invocation.
 	if parser.ShowHelp || !parser.CommandTree.Func.IsValid() {
-		_, err := HelpWriter.Write([]byte(cmdhelp.Help(parser.CommandTree, parser.Name)))
+		_, err := w.Write([]byte(cmdhelp.Help(parser.CommandTree, parser.Ancestors(), parser.Name)))
 		return err
 	}
 
 	// Make sure that after all the args are passed, that we're in a valid
 	// parsing state to leave things on.
 	if err := parser.NoMoreArgs(); err != nil {
-		return err
+		return UsageError{Err: err}
+	}
+
+	// Give the configs a chance to validate themselves. These errors are
+	// still a matter of incorrect invocation, so they're usage errors. Unlike
+	// parsing errors, they come from user code, so they're given the same
+	// context as errors from the command func.
+	if err := parser.Validate(); err != nil {
+		return UsageError{
+			Err:   fmt.Errorf("%s: %w", strings.Join(parser.Name, " "), err),
+			Usage: cmdhelp.Usage(parser.CommandTree, parser.Ancestors(), parser.Name),
+		}
+	}
+
+	// If the user passed the special timeout flag, put a deadline on the
+	// context the command will receive.
+	if parser.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, parser.Timeout)
+		defer cancel()
 	}
 
 	out := parser.CommandTree.Func.Call([]reflect.Value{
@@ -4,13 +4,21 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"io/ioutil"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/ucarion/cli/internal/cmdhelp"
 	"github.com/ucarion/cli/internal/cmdtree"
 	"github.com/ucarion/cli/internal/exectree"
+	"github.com/ucarion/cli/internal/param"
 )
 
 func TestExec_Basic(t *testing.T) {
@@ -26,7 +34,7 @@ func TestExec_Basic(t *testing.T) {
 	})
 
 	assert.NoError(t, err)
-	assert.NoError(t, exectree.Exec(context.Background(), tree, []string{"a"}))
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"a"}, nil))
 	assert.True(t, called)
 }
 
@@ -42,7 +50,7 @@ func TestExec_FuncError(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t,
 		"a: dummy err",
-		exectree.Exec(context.Background(), tree, []string{"a"}).Error())
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"a"}, nil).Error())
 }
 
 func TestExec_ShortHelp(t *testing.T) {
@@ -56,17 +64,12 @@ func TestExec_ShortHelp(t *testing.T) {
 		},
 	})
 
-	initialHelpOut := exectree.HelpWriter
 	var helpBuf bytes.Buffer
-	exectree.HelpWriter = &helpBuf
-	defer func() {
-		exectree.HelpWriter = initialHelpOut
-	}()
 
 	assert.NoError(t, err)
-	assert.NoError(t, exectree.Exec(context.Background(), tree, []string{"./cmd", "-h"}))
+	assert.NoError(t, exectree.Exec(context.Background(), &helpBuf, tree, []string{"./cmd", "-h"}, nil))
 	assert.False(t, called)
-	assert.Equal(t, cmdhelp.Help(tree, []string{"./cmd"}), helpBuf.String())
+	assert.Equal(t, cmdhelp.Help(tree, nil, []string{"./cmd"}), helpBuf.String())
 }
 
 func TestExec_LongHelp(t *testing.T) {
@@ -82,17 +85,12 @@ func TestExec_LongHelp(t *testing.T) {
 		},
 	})
 
-	initialHelpOut := exectree.HelpWriter
 	var helpBuf bytes.Buffer
-	exectree.HelpWriter = &helpBuf
-	defer func() {
-		exectree.HelpWriter = initialHelpOut
-	}()
 
 	assert.NoError(t, err)
-	assert.NoError(t, exectree.Exec(context.Background(), tree, []string{"./cmd", "--help"}))
+	assert.NoError(t, exectree.Exec(context.Background(), &helpBuf, tree, []string{"./cmd", "--help"}, nil))
 	assert.False(t, called)
-	assert.Equal(t, cmdhelp.Help(tree, []string{"./cmd"}), helpBuf.String())
+	assert.Equal(t, cmdhelp.Help(tree, nil, []string{"./cmd"}), helpBuf.String())
 }
 
 func TestExec_SubcmdHelp(t *testing.T) {
@@ -109,17 +107,12 @@ func TestExec_SubcmdHelp(t *testing.T) {
 		},
 	})
 
-	initialHelpOut := exectree.HelpWriter
 	var helpBuf bytes.Buffer
-	exectree.HelpWriter = &helpBuf
-	defer func() {
-		exectree.HelpWriter = initialHelpOut
-	}()
 
 	assert.NoError(t, err)
-	assert.NoError(t, exectree.Exec(context.Background(), tree, []string{"cmd", "sub", "--help"}))
+	assert.NoError(t, exectree.Exec(context.Background(), &helpBuf, tree, []string{"cmd", "sub", "--help"}, nil))
 	assert.False(t, called)
-	assert.Equal(t, cmdhelp.Help(tree.Children["sub"].CommandTree, []string{"cmd", "sub"}), helpBuf.String())
+	assert.Equal(t, cmdhelp.Help(tree.Children["sub"].CommandTree, []cmdtree.CommandTree{tree}, []string{"cmd", "sub"}), helpBuf.String())
 }
 
 func TestExec_SubcmdFuncError(t *testing.T) {
@@ -137,7 +130,7 @@ func TestExec_SubcmdFuncError(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t,
 		"a sub: dummy err",
-		exectree.Exec(context.Background(), tree, []string{"a", "sub"}).Error())
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"a", "sub"}, nil).Error())
 }
 
 func TestExec_Flags(t *testing.T) {
@@ -268,7 +261,7 @@ func TestExec_Flags(t *testing.T) {
 			// To save on typing, the entries of testCases don't have the
 			// initial argv[0]. We'll add that in here.
 			args := append([]string{"cmd"}, tt.In...)
-			assert.NoError(t, exectree.Exec(context.Background(), tree, args))
+			assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, args, nil))
 		})
 	}
 }
@@ -285,11 +278,11 @@ func TestExec_UnknownFlags(t *testing.T) {
 	assert.NoError(t, err)
 
 	assert.Equal(t, "unknown option: --foo",
-		exectree.Exec(context.Background(), tree, []string{"cmd", "--foo"}).Error())
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--foo"}, nil).Error())
 	assert.Equal(t, "unknown option: --foo",
-		exectree.Exec(context.Background(), tree, []string{"cmd", "--foo=bar"}).Error())
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--foo=bar"}, nil).Error())
 	assert.Equal(t, "unknown option: -f",
-		exectree.Exec(context.Background(), tree, []string{"cmd", "-f"}).Error())
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "-f"}, nil).Error())
 }
 
 func TestExec_ValueOnBoolFlag(t *testing.T) {
@@ -304,8 +297,10 @@ func TestExec_ValueOnBoolFlag(t *testing.T) {
 	})
 
 	assert.NoError(t, err)
-	assert.Equal(t, "option --foo takes no value",
-		exectree.Exec(context.TODO(), tree, []string{"cmd", "--foo=bar"}).Error())
+	assert.Equal(t, "--foo: strconv.ParseBool: parsing \"bar\": invalid syntax",
+		exectree.Exec(context.TODO(), ioutil.Discard, tree, []string{"cmd", "--foo=bar"}, nil).Error())
+	assert.Equal(t, "option --help takes no value",
+		exectree.Exec(context.TODO(), ioutil.Discard, tree, []string{"cmd", "--help=bar"}, nil).Error())
 }
 
 func TestExec_NoValueForStringFlag(t *testing.T) {
@@ -322,9 +317,9 @@ func TestExec_NoValueForStringFlag(t *testing.T) {
 	assert.NoError(t, err)
 
 	assert.Equal(t, "option --foo requires a value",
-		exectree.Exec(context.TODO(), tree, []string{"cmd", "--foo"}).Error())
+		exectree.Exec(context.TODO(), ioutil.Discard, tree, []string{"cmd", "--foo"}, nil).Error())
 	assert.Equal(t, "option -f requires a value",
-		exectree.Exec(context.TODO(), tree, []string{"cmd", "-f"}).Error())
+		exectree.Exec(context.TODO(), ioutil.Discard, tree, []string{"cmd", "-f"}, nil).Error())
 }
 
 func TestExec_ErrSettingParamValue(t *testing.T) {
@@ -344,21 +339,21 @@ func TestExec_ErrSettingParamValue(t *testing.T) {
 	assert.NoError(t, err)
 
 	assert.Equal(t, "-a: strconv.ParseInt: parsing \"X\": invalid syntax",
-		exectree.Exec(context.TODO(), tree, []string{"cmd", "-aX"}).Error())
+		exectree.Exec(context.TODO(), ioutil.Discard, tree, []string{"cmd", "-aX"}, nil).Error())
 	assert.Equal(t, "-a: strconv.ParseInt: parsing \"X\": invalid syntax",
-		exectree.Exec(context.TODO(), tree, []string{"cmd", "-a", "X"}).Error())
+		exectree.Exec(context.TODO(), ioutil.Discard, tree, []string{"cmd", "-a", "X"}, nil).Error())
 	assert.Equal(t, "--alpha: strconv.ParseInt: parsing \"X\": invalid syntax",
-		exectree.Exec(context.TODO(), tree, []string{"cmd", "--alpha=X"}).Error())
+		exectree.Exec(context.TODO(), ioutil.Discard, tree, []string{"cmd", "--alpha=X"}, nil).Error())
 	assert.Equal(t, "--alpha: strconv.ParseInt: parsing \"X\": invalid syntax",
-		exectree.Exec(context.TODO(), tree, []string{"cmd", "--alpha", "X"}).Error())
+		exectree.Exec(context.TODO(), ioutil.Discard, tree, []string{"cmd", "--alpha", "X"}, nil).Error())
 	assert.Equal(t, "-b: strconv.ParseInt: parsing \"X\": invalid syntax",
-		exectree.Exec(context.TODO(), tree, []string{"cmd", "-bX"}).Error())
+		exectree.Exec(context.TODO(), ioutil.Discard, tree, []string{"cmd", "-bX"}, nil).Error())
 	assert.Equal(t, "--charlie: dummy errParam err",
-		exectree.Exec(context.TODO(), tree, []string{"cmd", "--charlie"}).Error())
+		exectree.Exec(context.TODO(), ioutil.Discard, tree, []string{"cmd", "--charlie"}, nil).Error())
 	assert.Equal(t, "z: strconv.ParseInt: parsing \"X\": invalid syntax",
-		exectree.Exec(context.TODO(), tree, []string{"cmd", "X"}).Error())
+		exectree.Exec(context.TODO(), ioutil.Discard, tree, []string{"cmd", "X"}, nil).Error())
 	assert.Equal(t, "z: strconv.ParseInt: parsing \"X\": invalid syntax",
-		exectree.Exec(context.TODO(), tree, []string{"cmd", "--", "X"}).Error())
+		exectree.Exec(context.TODO(), ioutil.Discard, tree, []string{"cmd", "--", "X"}, nil).Error())
 }
 
 func TestExec_PosArgs(t *testing.T) {
@@ -418,7 +413,7 @@ func TestExec_PosArgs(t *testing.T) {
 			// To save on typing, the entries of testCases don't have the
 			// initial argv[0]. We'll add that in here.
 			args := append([]string{"cmd"}, tt.In...)
-			assert.NoError(t, exectree.Exec(context.Background(), tree, args))
+			assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, args, nil))
 		})
 	}
 
@@ -440,11 +435,11 @@ func TestExec_ExtraPosArgs(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.Equal(t, "unexpected argument: c",
-		exectree.Exec(context.TODO(), tree, []string{"cmd", "a", "b", "c"}).Error())
+		exectree.Exec(context.TODO(), ioutil.Discard, tree, []string{"cmd", "a", "b", "c"}, nil).Error())
 
 	assert.NoError(t, err)
 	assert.Equal(t, "unexpected argument: c",
-		exectree.Exec(context.TODO(), tree, []string{"cmd", "a", "b", "--", "c"}).Error())
+		exectree.Exec(context.TODO(), ioutil.Discard, tree, []string{"cmd", "a", "b", "--", "c"}, nil).Error())
 }
 
 func TestExec_MissingPosArgs(t *testing.T) {
@@ -463,9 +458,9 @@ func TestExec_MissingPosArgs(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.Equal(t, "argument x requires a value",
-		exectree.Exec(context.TODO(), tree, []string{"cmd"}).Error())
+		exectree.Exec(context.TODO(), ioutil.Discard, tree, []string{"cmd"}, nil).Error())
 	assert.Equal(t, "argument y requires a value",
-		exectree.Exec(context.TODO(), tree, []string{"cmd", "a"}).Error())
+		exectree.Exec(context.TODO(), ioutil.Discard, tree, []string{"cmd", "a"}, nil).Error())
 }
 
 func TestExec_Subcmds(t *testing.T) {
@@ -515,11 +510,41 @@ func TestExec_Subcmds(t *testing.T) {
 			// To save on typing, the entries of testCases don't have the
 			// initial argv[0]. We'll add that in here.
 			args := append([]string{"cmd"}, tt.In...)
-			assert.NoError(t, exectree.Exec(context.Background(), tree, args))
+			assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, args, nil))
 		})
 	}
 }
 
+func TestExec_SubcmdAliases(t *testing.T) {
+	type rootArgs struct{}
+	type removeArgs struct {
+		Root  rootArgs `cli:"remove,subcmd" aliases:"rm"`
+		Force bool     `cli:"-f"`
+	}
+
+	var got removeArgs
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, a removeArgs) error {
+			got = a
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "rm", "-f"}, nil))
+	assert.Equal(t, removeArgs{Force: true}, got)
+
+	var buf bytes.Buffer
+	assert.NoError(t, exectree.Exec(context.Background(), &buf, tree, []string{"cmd", "rm", "--help"}, nil))
+	assert.Equal(t, `usage: cmd [<options>] remove [<options>]
+aliases: rm
+
+    -f            
+    -h, --help    display this help and exit
+
+`, buf.String())
+}
+
 func TestExec_UnknownSubcmd(t *testing.T) {
 	type rootArgs struct{}
 	type subArgs struct {
@@ -533,7 +558,457 @@ func TestExec_UnknownSubcmd(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t,
 		"unknown sub-command: foo, did you mean: sub?",
-		exectree.Exec(context.Background(), tree, []string{"cmd", "foo"}).Error())
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "foo"}, nil).Error())
+}
+
+func TestExec_Abbreviations(t *testing.T) {
+	type rootArgs struct {
+		Verbose bool   `cli:"--verbose"`
+		Version bool   `cli:"--version"`
+		Color   bool   `cli:"--color" negatable:"true" default:"true"`
+		Name    string `cli:"--name"`
+	}
+
+	type addressArgs struct {
+		Root rootArgs `cli:"address,subcmd"`
+	}
+
+	type addrlabelArgs struct {
+		Root rootArgs `cli:"addrlabel,subcmd"`
+	}
+
+	type routeArgs struct {
+		Root rootArgs `cli:"route,subcmd" aliases:"r"`
+	}
+
+	testCases := []struct {
+		In   []string
+		Name string
+		Out  rootArgs
+		Err  string
+	}{
+		{
+			In:  []string{"--verb", "addr"},
+			Err: "ambiguous sub-command: addr, could be: address, addrlabel",
+		},
+		{
+			In:   []string{"--verb", "addre"},
+			Name: "address",
+			Out:  rootArgs{Verbose: true, Color: true},
+		},
+		{
+			In:   []string{"--vers", "--no-c", "addrl"},
+			Name: "addrlabel",
+			Out:  rootArgs{Version: true},
+		},
+		{
+			In:   []string{"--na=foo", "ro"},
+			Name: "route",
+			Out:  rootArgs{Name: "foo", Color: true},
+		},
+		{
+			In:  []string{"--n", "foo", "ro"},
+			Err: "ambiguous option: --n, could be: --no-color, --name",
+		},
+		{
+			In:  []string{"--ver", "ro"},
+			Err: "ambiguous option: --ver, could be: --verbose, --version",
+		},
+		{
+			In:  []string{"--no-col=true", "ro"},
+			Err: "option --no-col takes no value",
+		},
+		{
+			In:  []string{"--xxx", "ro"},
+			Err: "unknown option: --xxx",
+		},
+		{
+			In:  []string{"xxx"},
+			Err: "unknown sub-command: xxx, did you mean: r?",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(strings.Join(tt.In, " "), func(t *testing.T) {
+			var name string
+			var got rootArgs
+			tree, err := cmdtree.NewWithOptions([]interface{}{
+				func(_ context.Context, a addressArgs) error {
+					name, got = "address", a.Root
+					return nil
+				},
+				func(_ context.Context, a addrlabelArgs) error {
+					name, got = "addrlabel", a.Root
+					return nil
+				},
+				func(_ context.Context, a routeArgs) error {
+					name, got = "route", a.Root
+					return nil
+				},
+			}, cmdtree.Options{Abbreviations: true})
+
+			assert.NoError(t, err)
+
+			err = exectree.Exec(context.Background(), ioutil.Discard, tree, append([]string{"cmd"}, tt.In...), nil)
+			if tt.Err != "" {
+				assert.EqualError(t, err, tt.Err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.Name, name)
+				assert.Equal(t, tt.Out, got)
+			}
+		})
+	}
+
+	// Without the option, only exact names are accepted.
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ routeArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.EqualError(t,
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--verb", "route"}, nil),
+		"unknown option: --verb")
+}
+
+type stashArgs struct {
+	Quiet bool `cli:"-q"`
+}
+
+func (stashArgs) DefaultSubcommand() string {
+	return "push"
+}
+
+func TestExec_DefaultSubcommand(t *testing.T) {
+	type pushArgs struct {
+		Stash    stashArgs `cli:"push,subcmd"`
+		Patch    bool      `cli:"-p,--patch"`
+		Pathspec []string  `cli:"pathspec..."`
+	}
+
+	type listArgs struct {
+		Stash stashArgs `cli:"list,subcmd"`
+	}
+
+	testCases := []struct {
+		In   []string
+		Name string
+		Out  interface{}
+		Err  string
+	}{
+		{
+			In:   []string{},
+			Name: "push",
+			Out:  pushArgs{},
+		},
+		{
+			In:   []string{"-q"},
+			Name: "push",
+			Out:  pushArgs{Stash: stashArgs{Quiet: true}},
+		},
+		{
+			In:   []string{"-q", "-p", "foo", "bar"},
+			Name: "push",
+			Out:  pushArgs{Stash: stashArgs{Quiet: true}, Patch: true, Pathspec: []string{"foo", "bar"}},
+		},
+		{
+			In:   []string{"--patch"},
+			Name: "push",
+			Out:  pushArgs{Patch: true},
+		},
+		{
+			In:   []string{"push", "foo"},
+			Name: "push",
+			Out:  pushArgs{Pathspec: []string{"foo"}},
+		},
+		{
+			In:   []string{"-q", "list"},
+			Name: "list",
+			Out:  listArgs{Stash: stashArgs{Quiet: true}},
+		},
+		{
+			In:   []string{"--", "foo"},
+			Name: "push",
+			Out:  pushArgs{Pathspec: []string{"foo"}},
+		},
+		{
+			In:   []string{"--", "list"},
+			Name: "push",
+			Out:  pushArgs{Pathspec: []string{"list"}},
+		},
+		{
+			In:   []string{"-q", "--", "-p"},
+			Name: "push",
+			Out:  pushArgs{Stash: stashArgs{Quiet: true}, Pathspec: []string{"-p"}},
+		},
+		{
+			In:   []string{"-qp"},
+			Name: "push",
+			Out:  pushArgs{Stash: stashArgs{Quiet: true}, Patch: true},
+		},
+		{
+			In:  []string{"--xxx"},
+			Err: "unknown option: --xxx",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(strings.Join(tt.In, " "), func(t *testing.T) {
+			var name string
+			var got interface{}
+			tree, err := cmdtree.New([]interface{}{
+				func(_ context.Context, a pushArgs) error {
+					name, got = "push", a
+					return nil
+				},
+				func(_ context.Context, a listArgs) error {
+					name, got = "list", a
+					return nil
+				},
+			})
+
+			assert.NoError(t, err)
+
+			err = exectree.Exec(context.Background(), ioutil.Discard, tree, append([]string{"stash"}, tt.In...), nil)
+			if tt.Err != "" {
+				assert.EqualError(t, err, tt.Err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.Name, name)
+				assert.Equal(t, tt.Out, got)
+			}
+		})
+	}
+
+	// Asking for help on the parent still shows the parent's help.
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ pushArgs) error { return nil },
+		func(_ context.Context, _ listArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, exectree.Exec(context.Background(), &buf, tree, []string{"stash", "--help"}, nil))
+	assert.Equal(t, `usage: stash [<options>] [list|push]
+default sub-command: push
+
+    -q            
+    -h, --help    display this help and exit
+
+`, buf.String())
+}
+
+func TestExec_ParentPosArgs(t *testing.T) {
+	type rootArgs struct {
+		Verbose bool   `cli:"-v"`
+		Cluster string `cli:"cluster"`
+	}
+
+	type nodesArgs struct {
+		Root rootArgs `cli:"nodes,subcmd"`
+		Pool string   `cli:"pool"`
+	}
+
+	type listArgs struct {
+		Nodes nodesArgs `cli:"list,subcmd"`
+		All   bool      `cli:"-a"`
+	}
+
+	var got listArgs
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, a listArgs) error {
+			got = a
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "prod", "-v", "nodes", "default", "list", "-a"}, nil))
+	assert.Equal(t, listArgs{
+		Nodes: nodesArgs{Root: rootArgs{Verbose: true, Cluster: "prod"}, Pool: "default"},
+		All:   true,
+	}, got)
+
+	assert.Equal(t,
+		"unknown sub-command: lst, did you mean: list?",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "prod", "nodes", "default", "lst"}, nil).Error())
+
+	var buf bytes.Buffer
+	assert.NoError(t, exectree.Exec(context.Background(), &buf, tree, []string{"cmd", "prod"}, nil))
+	assert.Equal(t, `usage: cmd [<options>] <cluster> nodes
+
+    -v            
+    -h, --help    display this help and exit
+
+`, buf.String())
+}
+
+type projectArgs struct {
+	Project string `cli:"project"`
+}
+
+func (projectArgs) DefaultSubcommand() string {
+	return "status"
+}
+
+func TestExec_ParentPosArgsAndDefaultSubcommand(t *testing.T) {
+	type statusArgs struct {
+		Root projectArgs `cli:"status,subcmd"`
+	}
+
+	type deployArgs struct {
+		Root projectArgs `cli:"deploy,subcmd"`
+	}
+
+	var name string
+	var got projectArgs
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, a statusArgs) error {
+			name, got = "status", a.Root
+			return nil
+		},
+		func(_ context.Context, a deployArgs) error {
+			name, got = "deploy", a.Root
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "foo"}, nil))
+	assert.Equal(t, "status", name)
+	assert.Equal(t, projectArgs{Project: "foo"}, got)
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "deploy", "deploy"}, nil))
+	assert.Equal(t, "deploy", name)
+	assert.Equal(t, projectArgs{Project: "deploy"}, got)
+
+	// After the flag terminator, the arg after the project isn't a sub-command.
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--", "deploy"}, nil))
+	assert.Equal(t, "status", name)
+	assert.Equal(t, projectArgs{Project: "deploy"}, got)
+
+	assert.Equal(t,
+		"unexpected argument: deploy",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--", "foo", "deploy"}, nil).Error())
+
+	assert.Equal(t,
+		"argument project requires a value",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd"}, nil).Error())
+}
+
+func TestExec_PersistentFlags(t *testing.T) {
+	type rootArgs struct {
+		Verbose int      `cli:"-v,--verbose" counter:"true" persistent:"true"`
+		Tags    []string `cli:"--tag" value:"tag" default:"a" persistent:"true"`
+		Project string   `cli:"--project" required:"true" persistent:"true"`
+		Force   bool     `cli:"-f"`
+	}
+
+	type deployArgs struct {
+		Root   rootArgs `cli:"deploy,subcmd"`
+		DryRun bool     `cli:"-n"`
+	}
+
+	var got deployArgs
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, a deployArgs) error {
+			got = a
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		In  []string
+		Out deployArgs
+		Err string
+	}{
+		{
+			In:  []string{"--project=x", "deploy"},
+			Out: deployArgs{Root: rootArgs{Tags: []string{"a"}, Project: "x"}},
+		},
+		{
+			In:  []string{"deploy", "--project", "x", "-vnv", "--tag=b", "--tag=c"},
+			Out: deployArgs{Root: rootArgs{Verbose: 2, Tags: []string{"b", "c"}, Project: "x"}, DryRun: true},
+		},
+		{
+			In:  []string{"-v", "--tag=b", "deploy", "-v", "--tag=c", "--project=x"},
+			Out: deployArgs{Root: rootArgs{Verbose: 2, Tags: []string{"b", "c"}, Project: "x"}},
+		},
+		{
+			In:  []string{"deploy", "-n"},
+			Err: "missing required option: --project",
+		},
+		{
+			In:  []string{"deploy", "--project=x", "-f"},
+			Err: "unknown option: -f",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(strings.Join(tt.In, " "), func(t *testing.T) {
+			got = deployArgs{}
+			err := exectree.Exec(context.Background(), ioutil.Discard, tree, append([]string{"cmd"}, tt.In...), nil)
+			if tt.Err != "" {
+				assert.EqualError(t, err, tt.Err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.Out, got)
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, exectree.Exec(context.Background(), &buf, tree, []string{"cmd", "deploy", "--help"}, nil))
+	assert.Equal(t, `usage: cmd [<options>] deploy [<options>] --project <string>
+
+    -n            
+    -h, --help    display this help and exit
+
+Inherited options:
+    -v, --verbose             (repeatable)
+        --tag <tag>           (default: a)
+        --project <string>    
+
+`, buf.String())
+}
+
+func TestExec_PersistentHelpShortName(t *testing.T) {
+	type rootArgs struct {
+		Host string `cli:"-h,--host" persistent:"true"`
+	}
+
+	type subArgs struct {
+		Root rootArgs `cli:"sub,subcmd"`
+	}
+
+	var got subArgs
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, a subArgs) error {
+			got = a
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "sub", "-h", "example.com"}, nil))
+	assert.Equal(t, subArgs{Root: rootArgs{Host: "example.com"}}, got)
+
+	var buf bytes.Buffer
+	assert.NoError(t, exectree.Exec(context.Background(), &buf, tree, []string{"cmd", "sub", "--help"}, nil))
+	assert.Equal(t, `usage: cmd [<options>] sub [<options>]
+
+        --help    display this help and exit
+
+Inherited options:
+    -h, --host <string>    
+
+`, buf.String())
 }
 
 func TestExec_NonExecableCommand(t *testing.T) {
@@ -546,16 +1021,11 @@ func TestExec_NonExecableCommand(t *testing.T) {
 		func(_ context.Context, _ subArgs) error { return nil },
 	})
 
-	initialHelpOut := exectree.HelpWriter
 	var helpBuf bytes.Buffer
-	exectree.HelpWriter = &helpBuf
-	defer func() {
-		exectree.HelpWriter = initialHelpOut
-	}()
 
 	assert.NoError(t, err)
-	assert.NoError(t, exectree.Exec(context.Background(), tree, []string{"cmd"}))
-	assert.Equal(t, cmdhelp.Help(tree, []string{"cmd"}), helpBuf.String())
+	assert.NoError(t, exectree.Exec(context.Background(), &helpBuf, tree, []string{"cmd"}, nil))
+	assert.Equal(t, cmdhelp.Help(tree, nil, []string{"cmd"}), helpBuf.String())
 }
 
 func TestExec_GamutOfTypes(t *testing.T) {
@@ -705,7 +1175,7 @@ func TestExec_GamutOfTypes(t *testing.T) {
 			// To save on typing, the entries of testCases don't have the
 			// initial argv[0]. We'll add that in here.
 			args := append([]string{"cmd"}, tt.In...)
-			assert.NoError(t, exectree.Exec(context.Background(), tree, args))
+			assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, args, nil))
 		})
 	}
 }
@@ -730,3 +1200,981 @@ type errParam struct{}
 func (p errParam) UnmarshalText(_ []byte) error {
 	return errors.New("dummy errParam err")
 }
+
+func TestExec_UsageError(t *testing.T) {
+	type args struct {
+		Foo string `cli:"--foo"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ args) error {
+			return errors.New("dummy err")
+		},
+	})
+
+	assert.NoError(t, err)
+
+	testCases := [][]string{
+		{"cmd", "--bar"},
+		{"cmd", "--foo"},
+		{"cmd", "xxx"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(strings.Join(tt, " "), func(t *testing.T) {
+			var usageErr exectree.UsageError
+			err := exectree.Exec(context.Background(), ioutil.Discard, tree, tt, nil)
+			assert.True(t, errors.As(err, &usageErr))
+			assert.Equal(t, exectree.ExitCodeUsage, usageErr.ExitCode())
+		})
+	}
+
+	// Errors returned from the command's func are not usage errors.
+	var usageErr exectree.UsageError
+	err = exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd"}, nil)
+	assert.False(t, errors.As(err, &usageErr))
+}
+
+func TestExec_TimeoutFlag(t *testing.T) {
+	type rootArgs struct{}
+	type subArgs struct {
+		Root rootArgs `cli:"sub,subcmd"`
+	}
+
+	testCases := [][]string{
+		{"cmd", "--timeout", "1h", "sub"},
+		{"cmd", "--timeout=1h", "sub"},
+		{"cmd", "sub", "--timeout", "1h"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(strings.Join(tt, " "), func(t *testing.T) {
+			called := false
+			tree, err := cmdtree.NewWithOptions([]interface{}{
+				func(ctx context.Context, _ subArgs) error {
+					called = true
+					deadline, ok := ctx.Deadline()
+					assert.True(t, ok)
+					assert.WithinDuration(t, time.Now().Add(time.Hour), deadline, time.Minute)
+					return nil
+				},
+			}, cmdtree.Options{TimeoutFlag: true})
+
+			assert.NoError(t, err)
+			assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, tt, nil))
+			assert.True(t, called)
+		})
+	}
+
+	tree, err := cmdtree.NewWithOptions([]interface{}{
+		func(ctx context.Context, _ subArgs) error { return nil },
+	}, cmdtree.Options{TimeoutFlag: true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "--timeout: time: invalid duration \"xxx\"",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--timeout", "xxx"}, nil).Error())
+	assert.Equal(t, "option --timeout requires a value",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "sub", "--timeout"}, nil).Error())
+	assert.Equal(t, "--timeout: timeout must be positive, got: 0s",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--timeout", "0s"}, nil).Error())
+	assert.Equal(t, "--timeout: timeout must be positive, got: -1m",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "sub", "--timeout=-1m"}, nil).Error())
+}
+
+func TestExec_EnvVars(t *testing.T) {
+	type args struct {
+		A string   `cli:"-a,--alpha" env:"ALPHA"`
+		B bool     `cli:"--bravo" env:"BRAVO"`
+		C []string `cli:"--charlie" env:"CHARLIE"`
+		D int      `cli:"--delta"`
+	}
+
+	testCases := []struct {
+		In  []string
+		Env map[string]string
+		Out args
+	}{
+		{
+			In:  []string{},
+			Env: map[string]string{"ALPHA": "foo", "BRAVO": "true", "CHARLIE": "bar"},
+			Out: args{A: "foo", B: true, C: []string{"bar"}},
+		},
+		{
+			In:  []string{},
+			Env: map[string]string{"BRAVO": "false", "CMD_DELTA": "3"},
+			Out: args{D: 3},
+		},
+		{
+			In:  []string{},
+			Env: map[string]string{"ALPHA": ""},
+			Out: args{},
+		},
+		{
+			In:  []string{"-afoo", "--charlie=baz", "--charlie=qux"},
+			Env: map[string]string{"ALPHA": "xxx", "CHARLIE": "yyy"},
+			Out: args{A: "foo", C: []string{"baz", "qux"}},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(strings.Join(tt.In, " "), func(t *testing.T) {
+			tree, err := cmdtree.NewWithOptions([]interface{}{
+				func(ctx context.Context, args args) error {
+					assert.Equal(t, tt.Out, args)
+					return nil
+				},
+			}, cmdtree.Options{EnvPrefix: "CMD"})
+
+			assert.NoError(t, err)
+
+			lookupEnv := func(k string) (string, bool) {
+				v, ok := tt.Env[k]
+				return v, ok
+			}
+
+			args := append([]string{"cmd"}, tt.In...)
+			assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, args, lookupEnv))
+		})
+	}
+}
+
+func TestExec_BadEnvVar(t *testing.T) {
+	type args struct {
+		A int `cli:"--alpha" env:"ALPHA"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(ctx context.Context, args args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+
+	lookupEnv := func(k string) (string, bool) {
+		return "X", true
+	}
+
+	assert.Equal(t, "ALPHA: strconv.ParseInt: parsing \"X\": invalid syntax",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd"}, lookupEnv).Error())
+
+	// Invalid environment variables don't get in the way of asking for help.
+	var buf bytes.Buffer
+	assert.NoError(t, exectree.Exec(context.Background(), &buf, tree, []string{"cmd", "--help"}, lookupEnv))
+	assert.Equal(t, `usage: cmd [<options>]
+
+        --alpha <int>    (env: ALPHA)
+    -h, --help           display this help and exit
+
+`, buf.String())
+}
+
+func TestExec_Defaults(t *testing.T) {
+	type args struct {
+		A string   `cli:"-a,--alpha" default:"foo" env:"ALPHA"`
+		B int      `cli:"--bravo" default:"3"`
+		C []string `cli:"--charlie" default:"bar"`
+	}
+
+	testCases := []struct {
+		In  []string
+		Env map[string]string
+		Out args
+	}{
+		{
+			In:  []string{},
+			Out: args{A: "foo", B: 3, C: []string{"bar"}},
+		},
+		{
+			In:  []string{},
+			Env: map[string]string{"ALPHA": "xxx"},
+			Out: args{A: "xxx", B: 3, C: []string{"bar"}},
+		},
+		{
+			In:  []string{"-ayyy", "--bravo=4", "--charlie=baz", "--charlie=qux"},
+			Env: map[string]string{"ALPHA": "xxx"},
+			Out: args{A: "yyy", B: 4, C: []string{"baz", "qux"}},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(strings.Join(tt.In, " "), func(t *testing.T) {
+			tree, err := cmdtree.New([]interface{}{
+				func(ctx context.Context, args args) error {
+					assert.Equal(t, tt.Out, args)
+					return nil
+				},
+			})
+
+			assert.NoError(t, err)
+
+			lookupEnv := func(k string) (string, bool) {
+				v, ok := tt.Env[k]
+				return v, ok
+			}
+
+			args := append([]string{"cmd"}, tt.In...)
+			assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, args, lookupEnv))
+		})
+	}
+}
+
+func TestExec_RequiredFlags(t *testing.T) {
+	type rootArgs struct {
+		Project string `cli:"--project" required:"true"`
+	}
+
+	type subArgs struct {
+		Root   rootArgs `cli:"sub,subcmd"`
+		Region string   `cli:"-r,--region" required:"true" env:"REGION"`
+		Zone   string   `cli:"-z" required:"true"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(ctx context.Context, args subArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+
+	assert.Equal(t, "missing required options: --project, --region, -z",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "sub"}, nil).Error())
+	assert.Equal(t, "missing required options: --region, -z",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--project=x", "sub"}, nil).Error())
+	assert.Equal(t, "missing required option: -z",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--project=x", "sub", "-r", "y"}, nil).Error())
+	assert.NoError(t,
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--project=x", "sub", "-r", "y", "-zz"}, nil))
+
+	lookupEnv := func(k string) (string, bool) {
+		return "y", k == "REGION"
+	}
+
+	assert.NoError(t,
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--project=x", "sub", "-zz"}, lookupEnv))
+
+	// Help is still available when required options are missing.
+	assert.NoError(t,
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "sub", "--help"}, nil))
+}
+
+func TestExec_Enum(t *testing.T) {
+	type args struct {
+		Output string `cli:"-o,--output" enum:"json,yaml,table" env:"OUTPUT"`
+		Kind   string `cli:"kind" enum:"pod,node"`
+	}
+
+	var got args
+	tree, err := cmdtree.New([]interface{}{
+		func(ctx context.Context, a args) error {
+			got = a
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+
+	assert.NoError(t,
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "-o", "yaml", "pod"}, nil))
+	assert.Equal(t, args{Output: "yaml", Kind: "pod"}, got)
+
+	assert.Equal(t, "--output: invalid value: jsn, did you mean: json?",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--output=jsn", "pod"}, nil).Error())
+	assert.Equal(t, "kind: invalid value: nde, did you mean: node?",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "nde"}, nil).Error())
+
+	lookupEnv := func(k string) (string, bool) {
+		return "tabel", k == "OUTPUT"
+	}
+
+	assert.Equal(t, "OUTPUT: invalid value: tabel, did you mean: table?",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "pod"}, lookupEnv).Error())
+}
+
+func TestExec_FlagGroups(t *testing.T) {
+	type rootArgs struct {
+		JSON  bool `cli:"--json" exclusive:"output"`
+		Table bool `cli:"--table" exclusive:"output"`
+	}
+
+	type subArgs struct {
+		Root     rootArgs `cli:"sub,subcmd"`
+		Cert     string   `cli:"--cert" requires:"--key"`
+		Key      string   `cli:"--key"`
+		Token    string   `cli:"--token" anyof:"auth" env:"TOKEN"`
+		Password string   `cli:"--password" anyof:"auth"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(ctx context.Context, args subArgs) error { return nil },
+	})
+
+	assert.NoError(t, err)
+
+	assert.Equal(t, "options cannot be used together: --json, --table",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--json", "--table", "sub", "--token=x"}, nil).Error())
+	assert.Equal(t, "option --cert requires --key",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "sub", "--token=x", "--cert=x"}, nil).Error())
+	assert.Equal(t, "at least one of these options is required: --token, --password",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--json", "sub"}, nil).Error())
+	assert.NoError(t,
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--json", "sub", "--password=x", "--cert=x", "--key=x"}, nil))
+
+	lookupEnv := func(k string) (string, bool) {
+		return "x", k == "TOKEN"
+	}
+
+	assert.NoError(t,
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "sub"}, lookupEnv))
+}
+
+type validateRootArgs struct {
+	Min int `cli:"--min"`
+}
+
+func (a validateRootArgs) Validate() error {
+	if a.Min < 0 {
+		return errors.New("--min must not be negative")
+	}
+
+	return nil
+}
+
+type validateSubArgs struct {
+	Root validateRootArgs `cli:"sub,subcmd"`
+	Max  int              `cli:"--max"`
+}
+
+func (a *validateSubArgs) Validate() error {
+	if a.Max < a.Root.Min {
+		return errors.New("--max must not be less than --min")
+	}
+
+	// Validate may also normalize the config.
+	if a.Max == 0 {
+		a.Max = 10
+	}
+
+	return nil
+}
+
+func TestExec_Validate(t *testing.T) {
+	var got validateSubArgs
+	tree, err := cmdtree.New([]interface{}{
+		func(ctx context.Context, args validateSubArgs) error {
+			got = args
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+
+	// Parents are validated before their children.
+	err = exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--min=-1", "sub", "--max=-2"}, nil)
+	assert.Equal(t, "cmd sub: --min must not be negative\nusage: cmd [<options>] sub [<options>]", err.Error())
+
+	var usageErr exectree.UsageError
+	assert.True(t, errors.As(err, &usageErr))
+
+	err = exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--min=3", "sub", "--max=2"}, nil)
+	assert.Equal(t, "cmd sub: --max must not be less than --min\nusage: cmd [<options>] sub [<options>]", err.Error())
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "sub"}, nil))
+	assert.Equal(t, validateSubArgs{Max: 10}, got)
+}
+
+func TestExec_BoolValues(t *testing.T) {
+	type args struct {
+		Force  bool  `cli:"-f,--force"`
+		Color  bool  `cli:"--color" negatable:"true" default:"true"`
+		Cache  *bool `cli:"-c,--cache" negatable:"true"`
+		Pretty bool  `cli:"--pretty" env:"PRETTY"`
+	}
+
+	testCases := []struct {
+		In  []string
+		Out args
+		Err string
+	}{
+		{
+			In:  []string{},
+			Out: args{Color: true},
+		},
+		{
+			In:  []string{"--force=true", "--pretty=1"},
+			Out: args{Force: true, Color: true, Pretty: true},
+		},
+		{
+			In:  []string{"-f", "--force=false"},
+			Out: args{Color: true},
+		},
+		{
+			In:  []string{"--no-color"},
+			Out: args{},
+		},
+		{
+			In:  []string{"--color=0"},
+			Out: args{},
+		},
+		{
+			In:  []string{"-cf"},
+			Out: args{Force: true, Color: true, Cache: boolPtr(true)},
+		},
+		{
+			In:  []string{"--no-cache"},
+			Out: args{Color: true, Cache: boolPtr(false)},
+		},
+		{
+			In:  []string{"--cache=false"},
+			Out: args{Color: true, Cache: boolPtr(false)},
+		},
+		{
+			In:  []string{"--no-color=true"},
+			Err: "option --no-color takes no value",
+		},
+		{
+			In:  []string{"--no-force"},
+			Err: "unknown option: --no-force",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(strings.Join(tt.In, " "), func(t *testing.T) {
+			var got args
+			tree, err := cmdtree.New([]interface{}{
+				func(ctx context.Context, a args) error {
+					got = a
+					return nil
+				},
+			})
+
+			assert.NoError(t, err)
+
+			err = exectree.Exec(context.Background(), ioutil.Discard, tree, append([]string{"cmd"}, tt.In...), nil)
+			if tt.Err != "" {
+				assert.EqualError(t, err, tt.Err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.Out, got)
+			}
+		})
+	}
+
+	// Bools can be turned off by the environment, too.
+	var got args
+	tree, err := cmdtree.NewWithOptions([]interface{}{
+		func(ctx context.Context, a args) error {
+			got = a
+			return nil
+		},
+	}, cmdtree.Options{NegatableBools: true})
+
+	assert.NoError(t, err)
+
+	lookupEnv := func(k string) (string, bool) {
+		return "false", k == "PRETTY"
+	}
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--pretty", "--no-force"}, lookupEnv))
+	assert.Equal(t, args{Color: true, Pretty: true}, got)
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd"}, lookupEnv))
+	assert.Equal(t, args{Color: true}, got)
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestExec_Counter(t *testing.T) {
+	type args struct {
+		Verbose int   `cli:"-v,--verbose" counter:"true" env:"VERBOSE"`
+		Quiet   uint8 `cli:"-q" counter:"true"`
+		Force   bool  `cli:"-f"`
+	}
+
+	testCases := []struct {
+		In  []string
+		Out args
+		Err string
+	}{
+		{
+			In:  []string{},
+			Out: args{},
+		},
+		{
+			In:  []string{"-v"},
+			Out: args{Verbose: 1},
+		},
+		{
+			In:  []string{"-vvv", "-q"},
+			Out: args{Verbose: 3, Quiet: 1},
+		},
+		{
+			In:  []string{"-vfv", "--verbose", "-qq"},
+			Out: args{Verbose: 3, Quiet: 2, Force: true},
+		},
+		{
+			In:  []string{"--verbose=5", "-v"},
+			Out: args{Verbose: 6},
+		},
+		{
+			In:  []string{"--verbose=x"},
+			Err: "--verbose: strconv.ParseInt: parsing \"x\": invalid syntax",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(strings.Join(tt.In, " "), func(t *testing.T) {
+			var got args
+			tree, err := cmdtree.New([]interface{}{
+				func(ctx context.Context, a args) error {
+					got = a
+					return nil
+				},
+			})
+
+			assert.NoError(t, err)
+
+			err = exectree.Exec(context.Background(), ioutil.Discard, tree, append([]string{"cmd"}, tt.In...), nil)
+			if tt.Err != "" {
+				assert.EqualError(t, err, tt.Err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.Out, got)
+			}
+		})
+	}
+
+	// Counters given on the command line replace the count from the
+	// environment, rather than adding to it.
+	var got args
+	tree, err := cmdtree.New([]interface{}{
+		func(ctx context.Context, a args) error {
+			got = a
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+
+	lookupEnv := func(k string) (string, bool) {
+		return "2", k == "VERBOSE"
+	}
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd"}, lookupEnv))
+	assert.Equal(t, args{Verbose: 2}, got)
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "-v"}, lookupEnv))
+	assert.Equal(t, args{Verbose: 1}, got)
+}
+
+func TestExec_Map(t *testing.T) {
+	type args struct {
+		Labels map[string]string `cli:"-l,--label" default:"env=dev"`
+		Limits map[string]int    `cli:"--limit" uniquekeys:"true"`
+	}
+
+	testCases := []struct {
+		In  []string
+		Out args
+		Err string
+	}{
+		{
+			In:  []string{},
+			Out: args{Labels: map[string]string{"env": "dev"}},
+		},
+		{
+			In:  []string{"-l", "env=prod", "--label=team=infra"},
+			Out: args{Labels: map[string]string{"env": "prod", "team": "infra"}},
+		},
+		{
+			In:  []string{"--limit", "cpu=2", "--limit", "mem=4"},
+			Out: args{Labels: map[string]string{"env": "dev"}, Limits: map[string]int{"cpu": 2, "mem": 4}},
+		},
+		{
+			In:  []string{"--limit", "cpu=2", "--limit", "cpu=4"},
+			Err: "--limit: duplicate key: cpu",
+		},
+		{
+			In:  []string{"--limit", "cpu"},
+			Err: "--limit: expected key=value, got: cpu",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(strings.Join(tt.In, " "), func(t *testing.T) {
+			var got args
+			tree, err := cmdtree.New([]interface{}{
+				func(ctx context.Context, a args) error {
+					got = a
+					return nil
+				},
+			})
+
+			assert.NoError(t, err)
+
+			err = exectree.Exec(context.Background(), ioutil.Discard, tree, append([]string{"cmd"}, tt.In...), nil)
+			if tt.Err != "" {
+				assert.EqualError(t, err, tt.Err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.Out, got)
+			}
+		})
+	}
+}
+
+func TestExec_Separator(t *testing.T) {
+	type args struct {
+		Tags    []string      `cli:"--tags" sep:","`
+		Ports   []int         `cli:"-p" sep:"," env:"PORTS"`
+		Customs []customValue `cli:"--custom" sep:";"`
+		Formats []string      `cli:"--format" sep:"," enum:"json,yaml" default:"json,yaml"`
+	}
+
+	testCases := []struct {
+		In  []string
+		Out args
+		Err string
+	}{
+		{
+			In:  []string{},
+			Out: args{Formats: []string{"json", "yaml"}},
+		},
+		{
+			In:  []string{"--tags", "a,b", "--tags=c", "-p1,2", "--format=yaml"},
+			Out: args{Tags: []string{"a", "b", "c"}, Ports: []int{1, 2}, Formats: []string{"yaml"}},
+		},
+		{
+			In:  []string{"--tags", `a\,b,c`},
+			Out: args{Tags: []string{"a,b", "c"}, Formats: []string{"json", "yaml"}},
+		},
+		{
+			In:  []string{"--custom", "x;y,z"},
+			Out: args{Customs: []customValue{{"x"}, {"y,z"}}, Formats: []string{"json", "yaml"}},
+		},
+		{
+			In:  []string{"-p", "1,x"},
+			Err: "-p: strconv.ParseInt: parsing \"x\": invalid syntax",
+		},
+		{
+			In:  []string{"--format", "json,yml"},
+			Err: "--format: invalid value: yml, did you mean: yaml?",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(strings.Join(tt.In, " "), func(t *testing.T) {
+			var got args
+			tree, err := cmdtree.New([]interface{}{
+				func(ctx context.Context, a args) error {
+					got = a
+					return nil
+				},
+			})
+
+			assert.NoError(t, err)
+
+			err = exectree.Exec(context.Background(), ioutil.Discard, tree, append([]string{"cmd"}, tt.In...), nil)
+			if tt.Err != "" {
+				assert.EqualError(t, err, tt.Err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.Out, got)
+			}
+		})
+	}
+}
+
+func TestExec_TimeTypes(t *testing.T) {
+	type args struct {
+		Wait  time.Duration  `cli:"--wait" default:"30s"`
+		Since time.Time      `cli:"--since"`
+		Until *time.Time     `cli:"--until" layout:"2006-01-02"`
+		Limit param.ByteSize `cli:"--limit"`
+		Dates []time.Time    `cli:"dates..." layout:"2006-01-02"`
+	}
+
+	var got args
+	tree, err := cmdtree.New([]interface{}{
+		func(ctx context.Context, a args) error {
+			got = a
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd"}, nil))
+	assert.Equal(t, args{Wait: 30 * time.Second}, got)
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{
+		"cmd", "--wait=1m", "--since", "2020-01-02T03:04:05Z", "--until=2020-02-03",
+		"--limit", "10MiB", "2020-03-04",
+	}, nil))
+
+	until := time.Date(2020, 2, 3, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, args{
+		Wait:  time.Minute,
+		Since: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Until: &until,
+		Limit: 10 << 20,
+		Dates: []time.Time{time.Date(2020, 3, 4, 0, 0, 0, 0, time.UTC)},
+	}, got)
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--since=now-1h"}, nil))
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), got.Since, time.Minute)
+
+	assert.Equal(t, "--limit: invalid byte size unit: XB",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--limit=1XB"}, nil).Error())
+}
+
+func TestExec_NetworkTypes(t *testing.T) {
+	type args struct {
+		IP       net.IP         `cli:"--ip"`
+		Allow    []netip.Prefix `cli:"--allow"`
+		Addr     param.HostPort `cli:"--addr" defaultport:"443"`
+		Endpoint *url.URL       `cli:"--endpoint" schemes:"http,https"`
+		Peer     netip.Addr     `cli:"peer"`
+	}
+
+	var got args
+	tree, err := cmdtree.New([]interface{}{
+		func(ctx context.Context, a args) error {
+			got = a
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{
+		"cmd", "--ip=10.0.0.1", "--allow", "10.0.0.0/8", "--allow", "fd00::/8",
+		"--addr", "example.com", "--endpoint", "https://example.com/api", "::1",
+	}, nil))
+
+	assert.Equal(t, net.ParseIP("10.0.0.1"), got.IP)
+	assert.Equal(t, []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("fd00::/8")}, got.Allow)
+	assert.Equal(t, param.HostPort{Host: "example.com", Port: 443}, got.Addr)
+	assert.Equal(t, "https://example.com/api", got.Endpoint.String())
+	assert.Equal(t, netip.IPv6Loopback(), got.Peer)
+
+	assert.Equal(t, "--ip: invalid IP address: foo",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--ip=foo", "::1"}, nil).Error())
+
+	assert.Equal(t, "--endpoint: unsupported URL scheme: ftp, expected one of: http, https",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--endpoint=ftp://example.com", "::1"}, nil).Error())
+
+	assert.Equal(t, "peer: invalid IP address: localhost",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "localhost"}, nil).Error())
+}
+
+func TestExec_JSON(t *testing.T) {
+	type filter struct {
+		Status string `json:"status"`
+	}
+
+	type args struct {
+		Filter  filter            `cli:"--filter" format:"json"`
+		Where   *filter           `cli:"--where" format:"json"`
+		Labels  map[string]string `cli:"--labels" format:"json"`
+		Filters []filter          `cli:"filters..." format:"json"`
+	}
+
+	var got args
+	tree, err := cmdtree.New([]interface{}{
+		func(ctx context.Context, a args) error {
+			got = a
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "labels.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"app":"web"}`), 0644))
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{
+		"cmd", "--filter", `{"status":"open"}`, "--where", `{"status":"closed"}`, "--labels=@" + path, `{"status":"a"}`, `{"status":"b"}`,
+	}, nil))
+
+	assert.Equal(t, args{
+		Filter:  filter{Status: "open"},
+		Where:   &filter{Status: "closed"},
+		Labels:  map[string]string{"app": "web"},
+		Filters: []filter{{Status: "a"}, {Status: "b"}},
+	}, got)
+
+	assert.Equal(t, "--filter: invalid JSON: unexpected end of JSON input",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--filter", `{"status"`}, nil).Error())
+
+	assert.Equal(t, "option --where requires a value",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "--where"}, nil).Error())
+}
+
+func TestExec_OptionalPosArgs(t *testing.T) {
+	type args struct {
+		A string  `cli:"a"`
+		B *string `cli:"b"`
+		C *int    `cli:"c"`
+	}
+
+	var got args
+	tree, err := cmdtree.New([]interface{}{
+		func(ctx context.Context, a args) error {
+			got = a
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "x"}, nil))
+	assert.Equal(t, args{A: "x"}, got)
+
+	b, c := "y", 3
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "x", "y", "3"}, nil))
+	assert.Equal(t, args{A: "x", B: &b, C: &c}, got)
+
+	assert.Equal(t, "argument a requires a value",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd"}, nil).Error())
+
+	assert.Equal(t, "unexpected argument: z",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "x", "y", "3", "z"}, nil).Error())
+}
+
+func TestExec_PointerPosArgsBeforeRequiredTrailing(t *testing.T) {
+	type args struct {
+		Mode *string  `cli:"mode"`
+		Src  []string `cli:"src..." minargs:"1"`
+		Dst  string   `cli:"dst"`
+	}
+
+	var got args
+	tree, err := cmdtree.New([]interface{}{
+		func(ctx context.Context, a args) error {
+			got = a
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+
+	// The mode can't be left out, since the args that follow it need values.
+	mode := "a"
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "a", "b", "c"}, nil))
+	assert.Equal(t, args{Mode: &mode, Src: []string{"b"}, Dst: "c"}, got)
+
+	var buf bytes.Buffer
+	assert.NoError(t, exectree.Exec(context.Background(), &buf, tree, []string{"cmd", "--help"}, nil))
+	assert.Equal(t, `usage: cmd [<options>] <mode> <src>... <dst>
+
+    -h, --help    display this help and exit
+
+`, buf.String())
+}
+
+func TestExec_PointerPosArgBeforeRequired(t *testing.T) {
+	type args struct {
+		A *string `cli:"a"`
+		B string  `cli:"b"`
+	}
+
+	tree, err := cmdtree.New([]interface{}{
+		func(ctx context.Context, a args) error { return nil },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "argument b requires a value",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "x"}, nil).Error())
+}
+
+func TestExec_TrailingCounts(t *testing.T) {
+	type args struct {
+		PIDs []int `cli:"pids..." minargs:"2" maxargs:"3"`
+	}
+
+	var got args
+	tree, err := cmdtree.New([]interface{}{
+		func(ctx context.Context, a args) error {
+			got = a
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "1", "2"}, nil))
+	assert.Equal(t, args{PIDs: []int{1, 2}}, got)
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "1", "2", "3"}, nil))
+	assert.Equal(t, args{PIDs: []int{1, 2, 3}}, got)
+
+	assert.Equal(t, "argument pids requires at least 2 values",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "1"}, nil).Error())
+
+	assert.Equal(t, "argument pids takes at most 3 values, got: 4",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "1", "2", "3", "4"}, nil).Error())
+}
+
+func TestExec_PosArgsAfterTrailing(t *testing.T) {
+	type args struct {
+		Force bool     `cli:"-f"`
+		Src   []string `cli:"src..." minargs:"1"`
+		Dest  string   `cli:"dest"`
+	}
+
+	var got args
+	tree, err := cmdtree.New([]interface{}{
+		func(ctx context.Context, a args) error {
+			got = a
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cp", "a", "-f", "b", "c"}, nil))
+	assert.Equal(t, args{Force: true, Src: []string{"a", "b"}, Dest: "c"}, got)
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cp", "a", "b"}, nil))
+	assert.Equal(t, args{Src: []string{"a"}, Dest: "b"}, got)
+
+	assert.Equal(t, "argument src requires a value",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cp", "a"}, nil).Error())
+
+	assert.Equal(t, "argument src requires a value",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cp"}, nil).Error())
+}
+
+func TestExec_PosArgsAfterBoundedTrailing(t *testing.T) {
+	type args struct {
+		A    int   `cli:"a"`
+		Rest []int `cli:"rest..." maxargs:"2"`
+		Y    int   `cli:"y"`
+		Z    int   `cli:"z"`
+	}
+
+	var got args
+	tree, err := cmdtree.New([]interface{}{
+		func(ctx context.Context, a args) error {
+			got = a
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "1", "2", "3"}, nil))
+	assert.Equal(t, args{A: 1, Y: 2, Z: 3}, got)
+
+	assert.NoError(t, exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "1", "2", "3", "4", "5"}, nil))
+	assert.Equal(t, args{A: 1, Rest: []int{2, 3}, Y: 4, Z: 5}, got)
+
+	assert.Equal(t, "argument y requires a value",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "1", "2"}, nil).Error())
+
+	assert.Equal(t, "argument rest takes at most 2 values, got: 6",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "1", "2", "3", "4", "5", "6"}, nil).Error())
+
+	assert.Equal(t, "rest: strconv.ParseInt: parsing \"x\": invalid syntax",
+		exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "1", "x", "3", "4"}, nil).Error())
+}
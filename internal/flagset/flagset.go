@@ -0,0 +1,205 @@
+// Package flagset adapts a FlagSet from the standard library's flag package
+// into a command func, so that the FlagSet can be mounted in a command tree.
+package flagset
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ucarion/cli/internal/exectree"
+	"github.com/ucarion/cli/internal/tagparse"
+)
+
+var (
+	ctxType         = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errType         = reflect.TypeOf((*error)(nil)).Elem()
+	valuesType      = reflect.TypeOf(values{})
+	boolValuesType  = reflect.TypeOf(boolValues{})
+	stringSliceType = reflect.TypeOf([]string(nil))
+)
+
+// lastSeq numbers the values given to options, across all options, so that
+// they can be passed to a FlagSet in the order they were given.
+var lastSeq int64
+
+// setting is a value given to an option, and when it was given.
+type setting struct {
+	seq   int64
+	value string
+}
+
+// values is the type of the field for each of a FlagSet's options. It records
+// the values given to the option as they're parsed.
+type values struct {
+	settings []setting
+}
+
+func (v *values) String() string {
+	return ""
+}
+
+func (v *values) Set(s string) error {
+	v.settings = append(v.settings, setting{seq: atomic.AddInt64(&lastSeq, 1), value: s})
+	return nil
+}
+
+// boolValues is like values, but for boolean flags, which are turned on by
+// being mentioned by name.
+type boolValues struct {
+	values
+}
+
+func (v *boolValues) IsBoolFlag() bool {
+	return true
+}
+
+// New returns a command func for fs, which is a child of the command whose
+// config type is parent. The command is named after fs.
+//
+// Each of fs's flags becomes an option. Flags with one-letter names become
+// short options, and the rest become long ones, which must be passed with two
+// dashes. Characters that can't be in option names, such as the dot in
+// "log.level", are replaced with dashes. The command's positional arguments are
+// collected together, like the ones that fs.Args returns.
+//
+// If a flag's name is still not a valid option name once its characters are
+// replaced, or if two flags become the same option, then New returns an error
+// instead of a command func. cmdtree.New reports such errors as-is.
+//
+// When the command runs, the values given to its options are passed to fs.Set
+// in the order they were given, and then fn is called with the parent's config
+// and the positional arguments.
+func New(fs *flag.FlagSet, parent reflect.Type, fn func(ctx context.Context, parent reflect.Value, args []string) error) interface{} {
+	fields := []reflect.StructField{{
+		Name: "Parent",
+		Type: parent,
+		Tag:  reflect.StructTag(fmt.Sprintf("cli:%q", fs.Name()+",subcmd")),
+	}}
+
+	// Each flag's field holds the raw values it was given, so that they can
+	// be passed along to fs as-is, in order.
+	flags := []*flag.Flag{}
+	names := map[string]string{}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+
+		name := displayName(f)
+		if _, tagErr := tagparse.Parse(reflect.StructTag(fmt.Sprintf("cli:%q", name))); tagErr != nil {
+			err = fmt.Errorf("flag %s of %s cannot be an option: %w", f.Name, fs.Name(), tagErr)
+			return
+		}
+
+		if other, ok := names[name]; ok {
+			err = fmt.Errorf("flags %s and %s of %s are both option %s", other, f.Name, fs.Name(), name)
+			return
+		}
+
+		names[name] = f.Name
+
+		valueName, usage := flag.UnquoteUsage(f)
+		tag := fmt.Sprintf("cli:%q usage:%q", name, usage)
+
+		typ := valuesType
+		if isBoolFlag(f) {
+			typ = boolValuesType
+		} else {
+			tag += fmt.Sprintf(" value:%q", valueName)
+		}
+
+		flags = append(flags, f)
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("Flag%d", len(flags)),
+			Type: typ,
+			Tag:  reflect.StructTag(tag),
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	fields = append(fields, reflect.StructField{
+		Name: "Args",
+		Type: stringSliceType,
+		Tag:  `cli:"args..."`,
+	})
+
+	config := reflect.StructOf(fields)
+	fnType := reflect.FuncOf([]reflect.Type{ctxType, config}, []reflect.Type{errType}, false)
+
+	return reflect.MakeFunc(fnType, func(in []reflect.Value) []reflect.Value {
+		err := call(fs, flags, in[0].Interface().(context.Context), in[1], fn)
+
+		out := reflect.New(errType).Elem()
+		if err != nil {
+			out.Set(reflect.ValueOf(err))
+		}
+
+		return []reflect.Value{out}
+	}).Interface()
+}
+
+func call(fs *flag.FlagSet, flags []*flag.Flag, ctx context.Context, config reflect.Value, fn func(ctx context.Context, parent reflect.Value, args []string) error) error {
+	type flagSetting struct {
+		flag *flag.Flag
+		setting
+	}
+
+	var settings []flagSetting
+	for i, f := range flags {
+		var v values
+		switch field := config.Field(i + 1).Interface().(type) {
+		case values:
+			v = field
+		case boolValues:
+			v = field.values
+		}
+
+		for _, s := range v.settings {
+			settings = append(settings, flagSetting{flag: f, setting: s})
+		}
+	}
+
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].seq < settings[j].seq
+	})
+
+	// The flag package only checks values when they're set, so errors here
+	// are still a matter of incorrect invocation.
+	for _, s := range settings {
+		if err := fs.Set(s.flag.Name, s.value); err != nil {
+			return exectree.UsageError{Err: fmt.Errorf("%s: %w", displayName(s.flag), err)}
+		}
+	}
+
+	return fn(ctx, config.Field(0), config.FieldByName("Args").Interface().([]string))
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func displayName(f *flag.Flag) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+
+		return '-'
+	}, f.Name)
+
+	if len(name) == 1 {
+		return "-" + name
+	}
+
+	return "--" + name
+}
@@ -0,0 +1,182 @@
+package flagset_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ucarion/cli/internal/cmdtree"
+	"github.com/ucarion/cli/internal/exectree"
+	"github.com/ucarion/cli/internal/flagset"
+)
+
+type rootArgs struct {
+	Verbose bool `cli:"-v,--verbose"`
+}
+
+func newTree(t *testing.T, fs *flag.FlagSet, fn func(context.Context, reflect.Value, []string) error) cmdtree.CommandTree {
+	tree, err := cmdtree.New([]interface{}{
+		func(_ context.Context, _ rootArgs) error { return nil },
+		flagset.New(fs, reflect.TypeOf(rootArgs{}), fn),
+	})
+
+	assert.NoError(t, err)
+	return tree
+}
+
+func TestNew(t *testing.T) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	port := fs.Int("port", 8080, "port to listen on")
+	debug := fs.Bool("d", false, "enable debugging")
+	wait := fs.Duration("wait", time.Second, "how long to `delay` requests")
+
+	var parent rootArgs
+	var args []string
+	tree := newTree(t, fs, func(_ context.Context, p reflect.Value, a []string) error {
+		parent = p.Interface().(rootArgs)
+		args = a
+		return nil
+	})
+
+	err := exectree.Exec(context.Background(), ioutil.Discard, tree, []string{
+		"cmd", "-v", "serve", "--port", "80", "-d", "--wait=1m", "foo", "bar",
+	}, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, rootArgs{Verbose: true}, parent)
+	assert.Equal(t, []string{"foo", "bar"}, args)
+	assert.Equal(t, 80, *port)
+	assert.Equal(t, true, *debug)
+	assert.Equal(t, time.Minute, *wait)
+}
+
+func TestNew_Order(t *testing.T) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+
+	var name string
+	fs.StringVar(&name, "name", "", "name to use")
+	fs.StringVar(&name, "n", "", "short for --name")
+
+	var calls []string
+	fs.Func("alpha", "first alphabetically", func(s string) error {
+		calls = append(calls, "alpha="+s)
+		return nil
+	})
+	fs.Func("zeta", "last alphabetically", func(s string) error {
+		calls = append(calls, "zeta="+s)
+		return nil
+	})
+
+	tree := newTree(t, fs, func(_ context.Context, _ reflect.Value, _ []string) error { return nil })
+
+	err := exectree.Exec(context.Background(), ioutil.Discard, tree, []string{
+		"cmd", "serve", "--name", "long", "--zeta", "1", "-n", "short", "--alpha", "2", "--zeta=3",
+	}, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "short", name)
+	assert.Equal(t, []string{"zeta=1", "alpha=2", "zeta=3"}, calls)
+}
+
+func TestNew_Help(t *testing.T) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.Int("port", 8080, "port to listen on")
+	fs.Bool("d", false, "enable debugging")
+	fs.Duration("wait", time.Second, "how long to `delay` requests")
+
+	tree := newTree(t, fs, func(_ context.Context, _ reflect.Value, _ []string) error { return nil })
+
+	var buf bytes.Buffer
+	err := exectree.Exec(context.Background(), &buf, tree, []string{"cmd", "serve", "--help"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `usage: cmd [<options>] serve [<options>] [<args>...]
+
+    -d                    enable debugging
+        --port <int>      port to listen on
+        --wait <delay>    how long to delay requests
+    -h, --help            display this help and exit
+
+`, buf.String())
+}
+
+func TestNew_InvalidValue(t *testing.T) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.Int("port", 8080, "port to listen on")
+
+	called := false
+	tree := newTree(t, fs, func(_ context.Context, _ reflect.Value, _ []string) error {
+		called = true
+		return nil
+	})
+
+	err := exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "serve", "--port", "foo"}, nil)
+	assert.False(t, called)
+
+	var usageErr exectree.UsageError
+	assert.True(t, errors.As(err, &usageErr))
+	assert.Equal(t, `cmd serve: --port: parse error`, err.Error())
+}
+
+func TestNew_InvalidOptionName(t *testing.T) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	level := fs.String("log.level", "info", "log `level`")
+
+	tree := newTree(t, fs, func(_ context.Context, _ reflect.Value, _ []string) error { return nil })
+
+	err := exectree.Exec(context.Background(), ioutil.Discard, tree, []string{"cmd", "serve", "--log-level", "debug"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "debug", *level)
+
+	var buf bytes.Buffer
+	err = exectree.Exec(context.Background(), &buf, tree, []string{"cmd", "serve", "--help"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `usage: cmd [<options>] serve [<options>] [<args>...]
+
+        --log-level <level>    log level
+    -h, --help                 display this help and exit
+
+`, buf.String())
+}
+
+func TestNew_BadOptionName(t *testing.T) {
+	testCases := []struct {
+		Names []string
+		Err   string
+	}{
+		{
+			Names: []string{"."},
+			Err:   "flag . of serve cannot be an option: invalid long flag name: --",
+		},
+		{
+			Names: []string{"2fa"},
+			Err:   "flag 2fa of serve cannot be an option: invalid long flag name: --2fa",
+		},
+		{
+			Names: []string{"log.level", "log-level"},
+			Err:   "flags log-level and log.level of serve are both option --log-level",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(strings.Join(tt.Names, " "), func(t *testing.T) {
+			fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+			for _, name := range tt.Names {
+				fs.String(name, "", "")
+			}
+
+			_, err := cmdtree.New([]interface{}{
+				func(_ context.Context, _ rootArgs) error { return nil },
+				flagset.New(fs, reflect.TypeOf(rootArgs{}), nil),
+			})
+
+			assert.EqualError(t, err, tt.Err)
+		})
+	}
+}
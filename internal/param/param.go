@@ -2,33 +2,179 @@ package param
 
 import (
 	"encoding"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
 	"reflect"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+// Options are settings that change how a param parses its input. They come
+// from struct tags other than the "cli" tag.
+type Options struct {
+	// Counter makes an integer param count how many times it's given, rather
+	// than requiring a value.
+	Counter bool
+
+	// UniqueKeys makes a map param reject keys that it's already been given.
+	UniqueKeys bool
+
+	// Separator, if non-empty, makes a slice param split its input on
+	// Separator, and parse each piece as a separate element. Separators
+	// preceded by a backslash are treated literally.
+	Separator string
+
+	// Layout, if non-empty, is the layout that a time param parses its input
+	// with, in the form accepted by time.Parse. It defaults to time.RFC3339.
+	Layout string
+
+	// DefaultPort, if non-zero, is the port that a HostPort param uses when
+	// its input has only a host.
+	DefaultPort uint16
+
+	// Schemes, if non-empty, are the only schemes that a URL param accepts.
+	Schemes []string
+
+	// Format, if non-empty, is the format that a param decodes its input
+	// from, instead of parsing it according to its type. The only supported
+	// format is FormatJSON.
+	Format string
+}
+
+// FormatJSON is the format for params that decode their input with
+// encoding/json. Inputs that start with "@" are the path to a file holding
+// the JSON to decode.
+const FormatJSON = "json"
+
 func MayTakeValue(p encoding.TextUnmarshaler) bool {
-	_, ok := p.(boolParam)
-	return !ok
+	return !IsBool(p) && !IsCounter(p)
 }
 
+// MustTakeValue returns whether p can't be given without a value. Pointers
+// need not be given one, unless they decode JSON, which has no empty value.
 func MustTakeValue(p encoding.TextUnmarshaler) bool {
-	_, ok1 := p.(boolParam)
-	_, ok2 := p.(ptrParam)
-	return !ok1 && !ok2
+	if ptr, ok := p.(ptrParam); ok {
+		return ptr.isJSON()
+	}
+
+	return !IsBool(p) && !IsCounter(p)
+}
+
+// IsPointer returns whether p is for a pointer, which is left nil unless it's
+// given.
+func IsPointer(p encoding.TextUnmarshaler) bool {
+	_, ok := p.(ptrParam)
+	return ok
+}
+
+// IsCounter returns whether p counts how many times it's given.
+func IsCounter(p encoding.TextUnmarshaler) bool {
+	_, ok := p.(counterParam)
+	return ok
+}
+
+// IsBool returns whether p is for a bool, a *bool, or a flag.Value whose
+// IsBoolFlag method returns true. Such params are turned on by being mentioned
+// by name, but can also be given an explicit value such as "false".
+func IsBool(p encoding.TextUnmarshaler) bool {
+	switch p := p.(type) {
+	case boolParam:
+		return true
+	case flagValueParam:
+		return p.isBoolFlag()
+	case ptrParam:
+		return p.t == reflect.TypeOf(false)
+	default:
+		return false
+	}
+}
+
+// NewWithOptions is like New, but lets opts change how the param parses its
+// input.
+func NewWithOptions(v interface{}, opts Options) (encoding.TextUnmarshaler, error) {
+	if opts.Format != "" && opts.Format != FormatJSON {
+		return nil, fmt.Errorf("unsupported format: %s", opts.Format)
+	}
+
+	if opts.Counter {
+		return newCounter(v)
+	}
+
+	p, err := newWithOptions(v, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := p.(sliceParam); opts.Separator != "" && !ok {
+		return nil, fmt.Errorf("separators are only supported for slices, got: %v", reflect.TypeOf(v).Elem())
+	}
+
+	if _, ok := p.(mapParam); opts.UniqueKeys && !ok {
+		return nil, fmt.Errorf("unique keys are only supported for maps, got: %v", reflect.TypeOf(v).Elem())
+	}
+
+	if opts.Layout != "" && baseType(reflect.TypeOf(v).Elem()) != timeType {
+		return nil, fmt.Errorf("layouts are only supported for times, got: %v", reflect.TypeOf(v).Elem())
+	}
+
+	if opts.DefaultPort != 0 && baseType(reflect.TypeOf(v).Elem()) != hostPortType {
+		return nil, fmt.Errorf("default ports are only supported for host:port pairs, got: %v", reflect.TypeOf(v).Elem())
+	}
+
+	if len(opts.Schemes) != 0 && !isURL(reflect.TypeOf(v).Elem()) {
+		return nil, fmt.Errorf("schemes are only supported for URLs, got: %v", reflect.TypeOf(v).Elem())
+	}
+
+	return p, nil
 }
 
 func New(v interface{}) (encoding.TextUnmarshaler, error) {
+	return NewWithOptions(v, Options{})
+}
+
+func newWithOptions(v interface{}, opts Options) (encoding.TextUnmarshaler, error) {
+	if p, ok := newRegistered(v); ok {
+		return p, nil
+	}
+
+	if p, ok := newBuiltin(v, opts); ok {
+		return p, nil
+	}
+
 	// If the input is already a Param, just return it immediately.
 	if v, ok := v.(encoding.TextUnmarshaler); ok {
 		return v, nil
 	}
 
+	// Values from the standard library's flag package work much the same way.
+	if v, ok := v.(flag.Value); ok {
+		return flagValueParam{v}, nil
+	}
+
+	if _, ok := v.(json.Unmarshaler); ok {
+		return newJSON(v), nil
+	}
+
 	t := reflect.TypeOf(v)
 	if t.Kind() != reflect.Ptr {
 		return nil, fmt.Errorf("v must be a pointer")
 	}
 
+	// Structs and maps in JSON are decoded in one go, but slices are still
+	// built up an element at a time, and pointers still need not be given a
+	// value.
+	if k := t.Elem().Kind(); opts.Format == FormatJSON && k != reflect.Slice && k != reflect.Ptr {
+		return newJSON(v), nil
+	}
+
 	switch t := t.Elem(); t.Kind() {
 	case reflect.Slice:
 		// The user inputted a pointer to a slice. That means we should use
@@ -36,11 +182,11 @@ func New(v interface{}) (encoding.TextUnmarshaler, error) {
 		// of elements of the given slice. We should thus immediately make sure
 		// that the underlying type is Param-able.
 		elem := reflect.New(t.Elem()).Interface()
-		if _, err := newNoSliceOrPointer(elem); err != nil {
+		if _, err := newNoSliceOrPointer(elem, opts); err != nil {
 			return nil, fmt.Errorf("unsupported slice param type: %w", err)
 		}
 
-		return sliceParam{t.Elem(), reflect.ValueOf(v)}, nil
+		return sliceParam{t: t.Elem(), v: reflect.ValueOf(v), opts: opts}, nil
 	case reflect.Ptr:
 		// The user inputted a pointer to a pointer. That means we should use
 		// ptrParam.
@@ -48,17 +194,158 @@ func New(v interface{}) (encoding.TextUnmarshaler, error) {
 		// See comment above for slices -- a similar logic holds here to make
 		// sure that the pointed-at type is Param-able.
 		elem := reflect.New(t.Elem()).Interface()
-		if _, err := newNoSliceOrPointer(elem); err != nil {
+		if _, err := newNoSliceOrPointer(elem, opts); err != nil {
 			return nil, fmt.Errorf("unsupported pointer param type: %w", err)
 		}
 
-		return ptrParam{t.Elem(), reflect.ValueOf(v)}, nil
+		return ptrParam{t: t.Elem(), v: reflect.ValueOf(v), opts: opts}, nil
+	case reflect.Map:
+		// The user inputted a pointer to a map. That means we should use
+		// mapParam, so long as the map's keys are strings. The same logic as
+		// for slices holds for the map's values.
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported param type: %v", t)
+		}
+
+		elem := reflect.New(t.Elem()).Interface()
+		if _, err := newNoSliceOrPointer(elem, opts); err != nil {
+			return nil, fmt.Errorf("unsupported map param type: %w", err)
+		}
+
+		return mapParam{t: t, v: reflect.ValueOf(v), opts: opts}, nil
+	default:
+		return newNoSliceOrPointer(v, opts)
+	}
+}
+
+// baseType returns the type that t's param ultimately parses each value into.
+// That's t itself, unless t is a slice, pointer, or map.
+func baseType(t reflect.Type) reflect.Type {
+	switch t.Kind() {
+	case reflect.Slice, reflect.Ptr, reflect.Map:
+		return t.Elem()
+	default:
+		return t
+	}
+}
+
+// Parser parses values of a type that this package doesn't otherwise support.
+// See Register.
+type Parser struct {
+	// Parse parses s into a value of the registered type.
+	Parse func(s string) (reflect.Value, error)
+
+	// ValueName, if non-empty, is returned by ValueName for the registered
+	// type.
+	ValueName string
+
+	// Autocomplete, if non-nil, returns suggestions for values of the
+	// registered type.
+	Autocomplete func() []string
+}
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = map[reflect.Type]Parser{}
+)
+
+// Register makes params of type t be parsed by p, replacing any parser
+// previously registered for t. Registered parsers take precedence over all of
+// this package's other ways of parsing a type.
+func Register(t reflect.Type, p Parser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+
+	parsers[t] = p
+}
+
+func lookupParser(t reflect.Type) (Parser, bool) {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+
+	p, ok := parsers[t]
+	return p, ok
+}
+
+// Autocomplete returns suggestions for values of type t, if a parser that can
+// autocomplete has been registered for t, or for what t is a slice or pointer
+// of.
+func Autocomplete(t reflect.Type) ([]string, bool) {
+	p, ok := lookupParser(t)
+	if !ok && t.Kind() != reflect.Map {
+		p, ok = lookupParser(baseType(t))
+	}
+
+	if !ok || p.Autocomplete == nil {
+		return nil, false
+	}
+
+	return p.Autocomplete(), true
+}
+
+// newRegistered returns a param for v if a parser has been registered for the
+// type v points to, and whether there was such a parser.
+func newRegistered(v interface{}) (encoding.TextUnmarshaler, bool) {
+	t := reflect.TypeOf(v)
+	if t.Kind() != reflect.Ptr {
+		return nil, false
+	}
+
+	p, ok := lookupParser(t.Elem())
+	if !ok {
+		return nil, false
+	}
+
+	return registeredParam{v: reflect.ValueOf(v), parser: p}, true
+}
+
+type registeredParam struct {
+	v      reflect.Value
+	parser Parser
+}
+
+func (p registeredParam) UnmarshalText(s []byte) error {
+	v, err := p.parser.Parse(string(s))
+	if err != nil {
+		return err
+	}
+
+	p.v.Elem().Set(v)
+	return nil
+}
+
+// newBuiltin returns a param for the types that this package parses in its
+// own way, and whether v is one of those types. Some of these types implement
+// TextUnmarshaler, but we want to support other inputs than their UnmarshalText
+// does, or give clearer errors.
+func newBuiltin(v interface{}, opts Options) (encoding.TextUnmarshaler, bool) {
+	switch v := v.(type) {
+	case *time.Time:
+		return newTime(v, opts.Layout), true
+	case *net.IP:
+		return ipParam{v}, true
+	case *netip.Addr:
+		return addrParam{v}, true
+	case *netip.Prefix:
+		return prefixParam{v}, true
+	case *HostPort:
+		return hostPortParam{v: v, defaultPort: opts.DefaultPort}, true
+	case **url.URL:
+		return urlParam{v: v, schemes: opts.Schemes}, true
 	default:
-		return newNoSliceOrPointer(v)
+		return nil, false
 	}
 }
 
-func newNoSliceOrPointer(v interface{}) (encoding.TextUnmarshaler, error) {
+func newNoSliceOrPointer(v interface{}, opts Options) (encoding.TextUnmarshaler, error) {
+	if p, ok := newRegistered(v); ok {
+		return p, nil
+	}
+
+	if p, ok := newBuiltin(v, opts); ok {
+		return p, nil
+	}
+
 	// If the input is already a Param, just return it immediately. We support
 	// this both here and in New because it's valid to have a slice or pointer
 	// to a custom type.
@@ -66,7 +353,17 @@ func newNoSliceOrPointer(v interface{}) (encoding.TextUnmarshaler, error) {
 		return v, nil
 	}
 
+	if v, ok := v.(flag.Value); ok {
+		return flagValueParam{v}, nil
+	}
+
+	if _, ok := v.(json.Unmarshaler); ok || opts.Format == FormatJSON {
+		return newJSON(v), nil
+	}
+
 	switch v := v.(type) {
+	case *time.Duration:
+		return durationParam{v}, nil
 	case *bool:
 		return boolParam{v}, nil
 	case *int:
@@ -101,16 +398,55 @@ func newNoSliceOrPointer(v interface{}) (encoding.TextUnmarshaler, error) {
 }
 
 type sliceParam struct {
-	t reflect.Type
-	v reflect.Value
+	t    reflect.Type
+	v    reflect.Value
+	opts Options
 }
 
 func (p sliceParam) UnmarshalText(s []byte) error {
+	if p.opts.Separator == "" {
+		return p.appendElem(s)
+	}
+
+	for _, piece := range SplitEscaped(string(s), p.opts.Separator) {
+		if err := p.appendElem([]byte(piece)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SplitEscaped splits s on sep, except where sep is preceded by a backslash.
+// Those backslashes are removed; all other backslashes are kept as-is.
+func SplitEscaped(s, sep string) []string {
+	var out []string
+	var piece strings.Builder
+
+	for len(s) > 0 {
+		switch {
+		case strings.HasPrefix(s, "\\"+sep):
+			piece.WriteString(sep)
+			s = s[1+len(sep):]
+		case strings.HasPrefix(s, sep):
+			out = append(out, piece.String())
+			piece.Reset()
+			s = s[len(sep):]
+		default:
+			piece.WriteByte(s[0])
+			s = s[1:]
+		}
+	}
+
+	return append(out, piece.String())
+}
+
+func (p sliceParam) appendElem(s []byte) error {
 	// z := new(T)
 	z := reflect.New(p.t)
 
 	// elem := New(&z)
-	elem, _ := New(z.Interface())
+	elem, _ := newNoSliceOrPointer(z.Interface(), p.opts)
 
 	// Update z's value via elem's Set
 	if err := elem.UnmarshalText(s); err != nil {
@@ -122,9 +458,51 @@ func (p sliceParam) UnmarshalText(s []byte) error {
 	return nil
 }
 
+type mapParam struct {
+	t    reflect.Type
+	v    reflect.Value
+	opts Options
+}
+
+func (p mapParam) UnmarshalText(s []byte) error {
+	// Only the first "=" separates the key from the value, so that values can
+	// themselves contain "=".
+	parts := strings.SplitN(string(s), "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("expected key=value, got: %s", s)
+	}
+
+	// *v = make(map[K]V), if *v is nil
+	m := p.v.Elem()
+	if m.IsNil() {
+		m.Set(reflect.MakeMap(p.t))
+	}
+
+	key := reflect.ValueOf(parts[0]).Convert(p.t.Key())
+	if p.opts.UniqueKeys && m.MapIndex(key).IsValid() {
+		return fmt.Errorf("duplicate key: %s", parts[0])
+	}
+
+	// z := new(V)
+	z := reflect.New(p.t.Elem())
+
+	// elem := New(&z)
+	elem, _ := newNoSliceOrPointer(z.Interface(), p.opts)
+
+	// Update z's value via elem's Set
+	if err := elem.UnmarshalText([]byte(parts[1])); err != nil {
+		return fmt.Errorf("%s: %w", parts[0], err)
+	}
+
+	// (*v)[key] = *z
+	m.SetMapIndex(key, z.Elem())
+	return nil
+}
+
 type ptrParam struct {
-	t reflect.Type
-	v reflect.Value
+	t    reflect.Type
+	v    reflect.Value
+	opts Options
 }
 
 func (p ptrParam) UnmarshalText(s []byte) error {
@@ -132,7 +510,7 @@ func (p ptrParam) UnmarshalText(s []byte) error {
 	z := reflect.New(p.t)
 
 	// elem := New(&z)
-	elem, _ := New(z.Interface())
+	elem, _ := newNoSliceOrPointer(z.Interface(), p.opts)
 
 	// Update z's value via elem's Set
 	if err := elem.UnmarshalText(s); err != nil {
@@ -144,12 +522,115 @@ func (p ptrParam) UnmarshalText(s []byte) error {
 	return nil
 }
 
+// isJSON returns whether p decodes the value it points to as JSON.
+func (p ptrParam) isJSON() bool {
+	elem, _ := newNoSliceOrPointer(reflect.New(p.t).Interface(), p.opts)
+	_, ok := elem.(jsonParam)
+	return ok
+}
+
+func newCounter(v interface{}) (encoding.TextUnmarshaler, error) {
+	switch reflect.TypeOf(v).Elem().Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		inner, err := newNoSliceOrPointer(v, Options{})
+		if err != nil {
+			return nil, err
+		}
+
+		return counterParam{inner: inner, v: reflect.ValueOf(v).Elem()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported counter param type: %v", reflect.TypeOf(v).Elem())
+	}
+}
+
+type counterParam struct {
+	inner encoding.TextUnmarshaler
+	v     reflect.Value
+}
+
+func (p counterParam) UnmarshalText(s []byte) error {
+	// An empty string is what a counter receives each time it's mentioned by
+	// name. Otherwise, the count is spelled out, as it is in environment
+	// variables.
+	if len(s) != 0 {
+		return p.inner.UnmarshalText(s)
+	}
+
+	switch p.v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		p.v.SetInt(p.v.Int() + 1)
+	default:
+		p.v.SetUint(p.v.Uint() + 1)
+	}
+
+	return nil
+}
+
 type boolParam struct {
 	v *bool
 }
 
-func (p boolParam) UnmarshalText(_ []byte) error {
-	*p.v = true
+func (p boolParam) UnmarshalText(s []byte) error {
+	// An empty string is what a bool receives when it's simply mentioned by
+	// name, which means to turn it on. Otherwise, the value is spelled out, as
+	// it is in environment variables.
+	if len(s) == 0 {
+		*p.v = true
+		return nil
+	}
+
+	v, err := strconv.ParseBool(string(s))
+	*p.v = v
+	return err
+}
+
+// flagValueParam adapts a flag.Value, including a flag.Getter, into a param.
+type flagValueParam struct {
+	v flag.Value
+}
+
+func (p flagValueParam) UnmarshalText(s []byte) error {
+	// Like bools, boolean flag.Values are turned on by being mentioned by name.
+	if len(s) == 0 && p.isBoolFlag() {
+		return p.v.Set("true")
+	}
+
+	return p.v.Set(string(s))
+}
+
+// isBoolFlag returns whether p's flag.Value is a boolean one, as the flag
+// package determines it.
+func (p flagValueParam) isBoolFlag() bool {
+	b, ok := p.v.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// jsonParam decodes its input with encoding/json.
+type jsonParam struct {
+	v reflect.Value
+}
+
+func newJSON(v interface{}) jsonParam {
+	return jsonParam{reflect.ValueOf(v)}
+}
+
+func (p jsonParam) UnmarshalText(s []byte) error {
+	if len(s) > 0 && s[0] == '@' {
+		var err error
+		if s, err = os.ReadFile(string(s[1:])); err != nil {
+			return err
+		}
+	}
+
+	// Decode into a fresh value, so that giving the param again replaces its
+	// value rather than merging into it.
+	z := reflect.New(p.v.Type().Elem())
+	if err := json.Unmarshal(s, z.Interface()); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	p.v.Elem().Set(z.Elem())
 	return nil
 }
 
@@ -281,3 +762,327 @@ func (p stringParam) UnmarshalText(s []byte) error {
 	*p.v = string(s)
 	return nil
 }
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	byteSizeType = reflect.TypeOf(ByteSize(0))
+	ipType       = reflect.TypeOf(net.IP{})
+	addrType     = reflect.TypeOf(netip.Addr{})
+	prefixType   = reflect.TypeOf(netip.Prefix{})
+	hostPortType = reflect.TypeOf(HostPort{})
+	urlType      = reflect.TypeOf(&url.URL{})
+)
+
+type durationParam struct {
+	v *time.Duration
+}
+
+func (p durationParam) UnmarshalText(s []byte) error {
+	v, err := time.ParseDuration(string(s))
+	*p.v = v
+	return err
+}
+
+type timeParam struct {
+	v      *time.Time
+	layout string
+}
+
+func newTime(v *time.Time, layout string) timeParam {
+	if layout == "" {
+		layout = time.RFC3339
+	}
+
+	return timeParam{v: v, layout: layout}
+}
+
+func (p timeParam) UnmarshalText(s []byte) error {
+	// Times can be given relative to the current time, such as "now-1h". The
+	// sign is part of what time.ParseDuration accepts.
+	if strings.HasPrefix(string(s), "now") {
+		var d time.Duration
+		if len(s) > len("now") {
+			var err error
+			if d, err = time.ParseDuration(string(s[len("now"):])); err != nil {
+				return fmt.Errorf("invalid relative time: %s", s)
+			}
+		}
+
+		*p.v = time.Now().Add(d)
+		return nil
+	}
+
+	v, err := time.Parse(p.layout, string(s))
+	*p.v = v
+	return err
+}
+
+// ByteSize is a number of bytes. As a param, it accepts a number followed by an
+// optional unit, such as "512", "10MiB", or "1.5GB". Units with an "i" are
+// powers of 1024, and the others are powers of 1000. Units are not
+// case-sensitive.
+type ByteSize int64
+
+var byteSizeUnits = []struct {
+	name string
+	size ByteSize
+}{
+	{"", 1},
+	{"b", 1},
+	{"k", 1e3},
+	{"kb", 1e3},
+	{"kib", 1 << 10},
+	{"m", 1e6},
+	{"mb", 1e6},
+	{"mib", 1 << 20},
+	{"g", 1e9},
+	{"gb", 1e9},
+	{"gib", 1 << 30},
+	{"t", 1e12},
+	{"tb", 1e12},
+	{"tib", 1 << 40},
+	{"p", 1e15},
+	{"pb", 1e15},
+	{"pib", 1 << 50},
+}
+
+func (b *ByteSize) UnmarshalText(s []byte) error {
+	str := strings.TrimSpace(string(s))
+
+	// Split the input into its number and its unit.
+	i := strings.IndexFunc(str, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+
+	if i == -1 {
+		i = len(str)
+	}
+
+	num, unit := str[:i], strings.ToLower(strings.TrimSpace(str[i:]))
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return fmt.Errorf("invalid byte size: %s", s)
+	}
+
+	for _, u := range byteSizeUnits {
+		if u.name == unit {
+			// math.MaxInt64 rounds up to 2^63 as a float64, which is itself
+			// out of range.
+			v := math.Round(n * float64(u.size))
+			if v >= math.MaxInt64 {
+				return fmt.Errorf("byte size out of range: %s", s)
+			}
+
+			*b = ByteSize(v)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid byte size unit: %s", str[i:])
+}
+
+// String formats b using the largest binary unit that represents it exactly,
+// such as "10MiB" or "1536B".
+func (b ByteSize) String() string {
+	units := []string{"PiB", "TiB", "GiB", "MiB", "KiB"}
+	for i, unit := range units {
+		size := ByteSize(1) << (10 * uint(len(units)-i))
+		if b != 0 && b%size == 0 {
+			return fmt.Sprintf("%d%s", b/size, unit)
+		}
+	}
+
+	return fmt.Sprintf("%dB", int64(b))
+}
+
+type ipParam struct {
+	v *net.IP
+}
+
+func (p ipParam) UnmarshalText(s []byte) error {
+	v := net.ParseIP(string(s))
+	if v == nil {
+		return fmt.Errorf("invalid IP address: %s", s)
+	}
+
+	*p.v = v
+	return nil
+}
+
+type addrParam struct {
+	v *netip.Addr
+}
+
+func (p addrParam) UnmarshalText(s []byte) error {
+	v, err := netip.ParseAddr(string(s))
+	if err != nil {
+		return fmt.Errorf("invalid IP address: %s", s)
+	}
+
+	*p.v = v
+	return nil
+}
+
+type prefixParam struct {
+	v *netip.Prefix
+}
+
+func (p prefixParam) UnmarshalText(s []byte) error {
+	v, err := netip.ParsePrefix(string(s))
+	if err != nil {
+		return fmt.Errorf("invalid CIDR prefix: %s", s)
+	}
+
+	*p.v = v
+	return nil
+}
+
+// HostPort is a network address made of a host and a port, such as
+// "example.com:443" or "[::1]:8080". As a param, its host may be empty, as in
+// ":8080".
+type HostPort struct {
+	Host string
+	Port uint16
+}
+
+// String formats h as "host:port", with brackets around IPv6 hosts.
+func (h HostPort) String() string {
+	return net.JoinHostPort(h.Host, strconv.Itoa(int(h.Port)))
+}
+
+type hostPortParam struct {
+	v           *HostPort
+	defaultPort uint16
+}
+
+func (p hostPortParam) UnmarshalText(s []byte) error {
+	host, port, err := net.SplitHostPort(string(s))
+
+	// If the input doesn't have a port, try again with the default one.
+	if err != nil && p.defaultPort != 0 {
+		host, port, err = net.SplitHostPort(fmt.Sprintf("%s:%d", s, p.defaultPort))
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid host:port: %s", s)
+	}
+
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port: %s", port)
+	}
+
+	*p.v = HostPort{Host: host, Port: uint16(n)}
+	return nil
+}
+
+type urlParam struct {
+	v       **url.URL
+	schemes []string
+}
+
+func (p urlParam) UnmarshalText(s []byte) error {
+	// url.Parse accepts almost anything as a relative URL, so we require a
+	// scheme to catch mistakes.
+	v, err := url.Parse(string(s))
+	if err != nil || v.Scheme == "" {
+		return fmt.Errorf("invalid URL: %s", s)
+	}
+
+	if len(p.schemes) != 0 && !containsFold(p.schemes, v.Scheme) {
+		return fmt.Errorf("unsupported URL scheme: %s, expected one of: %s", v.Scheme, strings.Join(p.schemes, ", "))
+	}
+
+	*p.v = v
+	return nil
+}
+
+func containsFold(ss []string, s string) bool {
+	for _, x := range ss {
+		if strings.EqualFold(x, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isJSON returns whether a param of type t decodes its values as JSON.
+func isJSON(t reflect.Type, opts Options) bool {
+	p, err := newWithOptions(reflect.New(t).Interface(), opts)
+	if err != nil {
+		return false
+	}
+
+	switch p.(type) {
+	case jsonParam:
+		return true
+	case sliceParam, ptrParam:
+		elem, _ := newNoSliceOrPointer(reflect.New(baseType(t)).Interface(), opts)
+		_, ok := elem.(jsonParam)
+		return ok
+	default:
+		return false
+	}
+}
+
+// isURL returns whether t is *url.URL, or a slice, pointer, or map of them.
+func isURL(t reflect.Type) bool {
+	return t == urlType || baseType(t) == urlType
+}
+
+// ValueName returns a name for the kind of value that a param of type t takes,
+// for use in help messages.
+func ValueName(t reflect.Type) string {
+	return ValueNameWithOptions(t, Options{})
+}
+
+// ValueNameWithOptions is like ValueName, but takes into account how opts
+// change the param's input.
+func ValueNameWithOptions(t reflect.Type, opts Options) string {
+	if isJSON(t, opts) {
+		return "json"
+	}
+
+	if p, ok := lookupParser(t); ok && p.ValueName != "" {
+		return p.ValueName
+	}
+
+	if t.Kind() == reflect.Map {
+		return "key=value"
+	}
+
+	// IPs and URLs are themselves a slice and a pointer, so they're checked
+	// before looking at what t is a slice or pointer of.
+	switch {
+	case t == ipType:
+		return "ip"
+	case t == urlType:
+		return "url"
+	}
+
+	if p, ok := lookupParser(baseType(t)); ok && p.ValueName != "" {
+		return p.ValueName
+	}
+
+	switch baseType(t) {
+	case ipType, addrType:
+		return "ip"
+	case prefixType:
+		return "cidr"
+	case hostPortType:
+		return "host:port"
+	case urlType:
+		return "url"
+	case durationType:
+		return "duration"
+	case timeType:
+		return "time"
+	case byteSizeType:
+		return "size"
+	}
+
+	return t.String()
+}
@@ -1,7 +1,18 @@
 package param_test
 
 import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/ucarion/cli/internal/param"
@@ -27,6 +38,13 @@ func TestMayMustTakeValue(t *testing.T) {
 	assert.False(t, param.MustTakeValue(p1))
 	assert.True(t, param.MustTakeValue(p2))
 	assert.False(t, param.MustTakeValue(p3))
+
+	var v4 *struct{}
+	p4, err := param.NewWithOptions(&v4, param.Options{Format: param.FormatJSON})
+	assert.NoError(t, err)
+
+	assert.True(t, param.MayTakeValue(p4))
+	assert.True(t, param.MustTakeValue(p4))
 }
 
 func TestNewNotPointer(t *testing.T) {
@@ -62,6 +80,589 @@ func TestNewBool(t *testing.T) {
 	}
 }
 
+func TestNewBoolWithValue(t *testing.T) {
+	var v bool
+	p, err := param.New(&v)
+	if assert.NoError(t, err) {
+		assert.NoError(t, p.UnmarshalText([]byte("true")))
+		assert.Equal(t, true, v)
+
+		assert.NoError(t, p.UnmarshalText([]byte("0")))
+		assert.Equal(t, false, v)
+
+		assert.Error(t, p.UnmarshalText([]byte("xxx")))
+	}
+}
+
+func TestIsBool(t *testing.T) {
+	var v1 bool
+	var v2 *bool
+	var v3 *string
+	var v4 []bool
+
+	p1, _ := param.New(&v1)
+	p2, _ := param.New(&v2)
+	p3, _ := param.New(&v3)
+	p4, _ := param.New(&v4)
+
+	assert.True(t, param.IsBool(p1))
+	assert.True(t, param.IsBool(p2))
+	assert.False(t, param.IsBool(p3))
+	assert.False(t, param.IsBool(p4))
+
+	assert.False(t, param.MayTakeValue(p2))
+	assert.False(t, param.MustTakeValue(p2))
+	assert.True(t, param.MayTakeValue(p3))
+}
+
+func TestNewCounter(t *testing.T) {
+	var v int
+	p, err := param.NewWithOptions(&v, param.Options{Counter: true})
+	if assert.NoError(t, err) {
+		assert.True(t, param.IsCounter(p))
+		assert.False(t, param.MayTakeValue(p))
+
+		assert.NoError(t, p.UnmarshalText([]byte("")))
+		assert.NoError(t, p.UnmarshalText([]byte("")))
+		assert.Equal(t, 2, v)
+
+		assert.NoError(t, p.UnmarshalText([]byte("5")))
+		assert.Equal(t, 5, v)
+	}
+
+	var s string
+	_, err = param.NewWithOptions(&s, param.Options{Counter: true})
+	assert.EqualError(t, err, "unsupported counter param type: string")
+}
+
+func TestNewMap(t *testing.T) {
+	var v map[string]int
+	p, err := param.New(&v)
+	if assert.NoError(t, err) {
+		assert.NoError(t, p.UnmarshalText([]byte("a=1")))
+		assert.NoError(t, p.UnmarshalText([]byte("b=2")))
+		assert.NoError(t, p.UnmarshalText([]byte("a=3")))
+		assert.Equal(t, map[string]int{"a": 3, "b": 2}, v)
+
+		assert.EqualError(t, p.UnmarshalText([]byte("a")), "expected key=value, got: a")
+		assert.EqualError(t, p.UnmarshalText([]byte("a=x")), "a: strconv.ParseInt: parsing \"x\": invalid syntax")
+	}
+}
+
+func TestNewMapSplitsOnFirstEquals(t *testing.T) {
+	var v map[string]string
+	p, err := param.New(&v)
+	if assert.NoError(t, err) {
+		assert.NoError(t, p.UnmarshalText([]byte("a=b=c")))
+		assert.NoError(t, p.UnmarshalText([]byte("d=")))
+		assert.Equal(t, map[string]string{"a": "b=c", "d": ""}, v)
+	}
+}
+
+func TestNewMapUniqueKeys(t *testing.T) {
+	var v map[string]string
+	p, err := param.NewWithOptions(&v, param.Options{UniqueKeys: true})
+	if assert.NoError(t, err) {
+		assert.NoError(t, p.UnmarshalText([]byte("a=1")))
+		assert.EqualError(t, p.UnmarshalText([]byte("a=2")), "duplicate key: a")
+		assert.Equal(t, map[string]string{"a": "1"}, v)
+	}
+
+	var s []string
+	_, err = param.NewWithOptions(&s, param.Options{UniqueKeys: true})
+	assert.EqualError(t, err, "unique keys are only supported for maps, got: []string")
+}
+
+func TestNewUnsupportedTypeMap(t *testing.T) {
+	var v map[string][]string
+	_, err := param.New(&v)
+	assert.EqualError(t, err, "unsupported map param type: unsupported param type: []string")
+}
+
+func TestNewSliceSeparator(t *testing.T) {
+	var v []int
+	p, err := param.NewWithOptions(&v, param.Options{Separator: ","})
+	if assert.NoError(t, err) {
+		assert.NoError(t, p.UnmarshalText([]byte("1,2")))
+		assert.NoError(t, p.UnmarshalText([]byte("3")))
+		assert.Equal(t, []int{1, 2, 3}, v)
+
+		assert.Error(t, p.UnmarshalText([]byte("4,x")))
+	}
+
+	var s string
+	_, err = param.NewWithOptions(&s, param.Options{Separator: ","})
+	assert.EqualError(t, err, "separators are only supported for slices, got: string")
+}
+
+func TestSplitEscaped(t *testing.T) {
+	assert.Equal(t, []string{"a", "b", "c"}, param.SplitEscaped("a,b,c", ","))
+	assert.Equal(t, []string{"a,b", "c"}, param.SplitEscaped(`a\,b,c`, ","))
+	assert.Equal(t, []string{`a\b`, ""}, param.SplitEscaped(`a\b,`, ","))
+	assert.Equal(t, []string{"a", "b::c"}, param.SplitEscaped(`a::b\::c`, "::"))
+	assert.Equal(t, []string{""}, param.SplitEscaped("", ","))
+}
+
+func TestNewDuration(t *testing.T) {
+	var v time.Duration
+	p, err := param.New(&v)
+	if assert.NoError(t, err) {
+		assert.NoError(t, p.UnmarshalText([]byte("1m30s")))
+		assert.Equal(t, 90*time.Second, v)
+
+		assert.Error(t, p.UnmarshalText([]byte("30")))
+	}
+}
+
+func TestNewTime(t *testing.T) {
+	var v time.Time
+	p, err := param.New(&v)
+	if assert.NoError(t, err) {
+		assert.NoError(t, p.UnmarshalText([]byte("2020-01-02T03:04:05Z")))
+		assert.Equal(t, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), v)
+
+		assert.NoError(t, p.UnmarshalText([]byte("now")))
+		assert.WithinDuration(t, time.Now(), v, time.Minute)
+
+		assert.NoError(t, p.UnmarshalText([]byte("now-1h")))
+		assert.WithinDuration(t, time.Now().Add(-time.Hour), v, time.Minute)
+
+		assert.NoError(t, p.UnmarshalText([]byte("now+90m")))
+		assert.WithinDuration(t, time.Now().Add(90*time.Minute), v, time.Minute)
+
+		assert.EqualError(t, p.UnmarshalText([]byte("now-xxx")), "invalid relative time: now-xxx")
+		assert.Error(t, p.UnmarshalText([]byte("2020-01-02")))
+	}
+}
+
+func TestNewTimeLayout(t *testing.T) {
+	var v []time.Time
+	p, err := param.NewWithOptions(&v, param.Options{Layout: "2006-01-02"})
+	if assert.NoError(t, err) {
+		assert.NoError(t, p.UnmarshalText([]byte("2020-01-02")))
+		assert.Equal(t, []time.Time{time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)}, v)
+	}
+
+	var s string
+	_, err = param.NewWithOptions(&s, param.Options{Layout: "2006-01-02"})
+	assert.EqualError(t, err, "layouts are only supported for times, got: string")
+}
+
+func TestNewByteSize(t *testing.T) {
+	testCases := []struct {
+		In  string
+		Out param.ByteSize
+		Err string
+	}{
+		{In: "512", Out: 512},
+		{In: "512B", Out: 512},
+		{In: "10MiB", Out: 10 << 20},
+		{In: "1.5GB", Out: 1500000000},
+		{In: "2 kib", Out: 2048},
+		{In: "1K", Out: 1000},
+		{In: "8191PiB", Out: 8191 << 50},
+		{In: "8192PiB", Err: "byte size out of range: 8192PiB"},
+		{In: "", Err: "invalid byte size: "},
+		{In: "MiB", Err: "invalid byte size: MiB"},
+		{In: "10XB", Err: "invalid byte size unit: XB"},
+		{In: "-1MiB", Err: "invalid byte size: -1MiB"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.In, func(t *testing.T) {
+			var v param.ByteSize
+			p, err := param.New(&v)
+			assert.NoError(t, err)
+
+			err = p.UnmarshalText([]byte(tt.In))
+			if tt.Err != "" {
+				assert.EqualError(t, err, tt.Err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.Out, v)
+			}
+		})
+	}
+}
+
+func TestByteSizeString(t *testing.T) {
+	assert.Equal(t, "0B", param.ByteSize(0).String())
+	assert.Equal(t, "1536B", param.ByteSize(1536).String())
+	assert.Equal(t, "2KiB", param.ByteSize(2048).String())
+	assert.Equal(t, "10MiB", param.ByteSize(10<<20).String())
+	assert.Equal(t, "3GiB", param.ByteSize(3<<30).String())
+}
+
+func TestValueName(t *testing.T) {
+	assert.Equal(t, "duration", param.ValueName(reflect.TypeOf(time.Duration(0))))
+	assert.Equal(t, "time", param.ValueName(reflect.TypeOf(time.Time{})))
+	assert.Equal(t, "time", param.ValueName(reflect.TypeOf([]time.Time{})))
+	assert.Equal(t, "size", param.ValueName(reflect.TypeOf(param.ByteSize(0))))
+	assert.Equal(t, "key=value", param.ValueName(reflect.TypeOf(map[string]int{})))
+	assert.Equal(t, "string", param.ValueName(reflect.TypeOf("")))
+	assert.Equal(t, "[]int", param.ValueName(reflect.TypeOf([]int{})))
+	assert.Equal(t, "ip", param.ValueName(reflect.TypeOf(net.IP{})))
+	assert.Equal(t, "ip", param.ValueName(reflect.TypeOf([]net.IP{})))
+	assert.Equal(t, "ip", param.ValueName(reflect.TypeOf(netip.Addr{})))
+	assert.Equal(t, "cidr", param.ValueName(reflect.TypeOf(netip.Prefix{})))
+	assert.Equal(t, "host:port", param.ValueName(reflect.TypeOf(param.HostPort{})))
+	assert.Equal(t, "url", param.ValueName(reflect.TypeOf(&url.URL{})))
+	assert.Equal(t, "url", param.ValueName(reflect.TypeOf([]*url.URL{})))
+}
+
+func TestNewIP(t *testing.T) {
+	var v net.IP
+	p, err := param.New(&v)
+	assert.NoError(t, err)
+
+	assert.NoError(t, p.UnmarshalText([]byte("10.0.0.1")))
+	assert.Equal(t, net.ParseIP("10.0.0.1"), v)
+
+	assert.NoError(t, p.UnmarshalText([]byte("::1")))
+	assert.Equal(t, net.IPv6loopback, v)
+
+	assert.EqualError(t, p.UnmarshalText([]byte("10.0.0")), "invalid IP address: 10.0.0")
+	assert.EqualError(t, p.UnmarshalText([]byte("")), "invalid IP address: ")
+}
+
+func TestNewIPSlice(t *testing.T) {
+	var v []net.IP
+	p, err := param.New(&v)
+	assert.NoError(t, err)
+
+	assert.NoError(t, p.UnmarshalText([]byte("10.0.0.1")))
+	assert.NoError(t, p.UnmarshalText([]byte("10.0.0.2")))
+	assert.Equal(t, []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}, v)
+}
+
+func TestNewAddr(t *testing.T) {
+	var v netip.Addr
+	p, err := param.New(&v)
+	assert.NoError(t, err)
+
+	assert.NoError(t, p.UnmarshalText([]byte("fe80::1")))
+	assert.Equal(t, netip.MustParseAddr("fe80::1"), v)
+
+	assert.EqualError(t, p.UnmarshalText([]byte("example.com")), "invalid IP address: example.com")
+}
+
+func TestNewPrefix(t *testing.T) {
+	var v netip.Prefix
+	p, err := param.New(&v)
+	assert.NoError(t, err)
+
+	assert.NoError(t, p.UnmarshalText([]byte("10.0.0.0/8")))
+	assert.Equal(t, netip.MustParsePrefix("10.0.0.0/8"), v)
+
+	assert.EqualError(t, p.UnmarshalText([]byte("10.0.0.0")), "invalid CIDR prefix: 10.0.0.0")
+	assert.EqualError(t, p.UnmarshalText([]byte("10.0.0.0/33")), "invalid CIDR prefix: 10.0.0.0/33")
+}
+
+func TestNewHostPort(t *testing.T) {
+	testCases := []struct {
+		In          string
+		DefaultPort uint16
+		Out         param.HostPort
+		Err         string
+	}{
+		{In: "example.com:80", Out: param.HostPort{Host: "example.com", Port: 80}},
+		{In: "[::1]:8080", Out: param.HostPort{Host: "::1", Port: 8080}},
+		{In: ":8080", Out: param.HostPort{Host: "", Port: 8080}},
+		{In: "example.com", Err: "invalid host:port: example.com"},
+		{In: "example.com:http", Err: "invalid port: http"},
+		{In: "example.com:65536", Err: "invalid port: 65536"},
+		{In: "example.com:80", DefaultPort: 443, Out: param.HostPort{Host: "example.com", Port: 80}},
+		{In: "example.com", DefaultPort: 443, Out: param.HostPort{Host: "example.com", Port: 443}},
+		{In: "[::1]", DefaultPort: 443, Out: param.HostPort{Host: "::1", Port: 443}},
+		{In: "a:b:c", DefaultPort: 443, Err: "invalid host:port: a:b:c"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.In, func(t *testing.T) {
+			var v param.HostPort
+			p, err := param.NewWithOptions(&v, param.Options{DefaultPort: tt.DefaultPort})
+			assert.NoError(t, err)
+
+			err = p.UnmarshalText([]byte(tt.In))
+			if tt.Err != "" {
+				assert.EqualError(t, err, tt.Err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.Out, v)
+			}
+		})
+	}
+}
+
+func TestHostPortString(t *testing.T) {
+	assert.Equal(t, "example.com:80", param.HostPort{Host: "example.com", Port: 80}.String())
+	assert.Equal(t, "[::1]:8080", param.HostPort{Host: "::1", Port: 8080}.String())
+}
+
+func TestNewHostPortDefaultPortUnsupported(t *testing.T) {
+	var v string
+	_, err := param.NewWithOptions(&v, param.Options{DefaultPort: 443})
+	assert.EqualError(t, err, "default ports are only supported for host:port pairs, got: string")
+}
+
+func TestNewURL(t *testing.T) {
+	var v *url.URL
+	p, err := param.New(&v)
+	assert.NoError(t, err)
+	assert.True(t, param.MustTakeValue(p))
+
+	assert.NoError(t, p.UnmarshalText([]byte("https://example.com/foo")))
+	assert.Equal(t, "https://example.com/foo", v.String())
+
+	assert.EqualError(t, p.UnmarshalText([]byte("example.com/foo")), "invalid URL: example.com/foo")
+	assert.EqualError(t, p.UnmarshalText([]byte("http://[::1")), "invalid URL: http://[::1")
+}
+
+func TestNewURLSchemes(t *testing.T) {
+	var v *url.URL
+	p, err := param.NewWithOptions(&v, param.Options{Schemes: []string{"http", "https"}})
+	assert.NoError(t, err)
+
+	assert.NoError(t, p.UnmarshalText([]byte("HTTPS://example.com")))
+	assert.Equal(t, "https", v.Scheme)
+
+	assert.EqualError(t, p.UnmarshalText([]byte("ftp://example.com")), "unsupported URL scheme: ftp, expected one of: http, https")
+}
+
+func TestNewURLSchemesUnsupported(t *testing.T) {
+	var v string
+	_, err := param.NewWithOptions(&v, param.Options{Schemes: []string{"http"}})
+	assert.EqualError(t, err, "schemes are only supported for URLs, got: string")
+}
+
+type registeredVersion struct {
+	Major, Minor int
+}
+
+func parseRegisteredVersion(s string) (reflect.Value, error) {
+	var v registeredVersion
+	if _, err := fmt.Sscanf(s, "v%d.%d", &v.Major, &v.Minor); err != nil {
+		return reflect.Value{}, fmt.Errorf("invalid version: %s", s)
+	}
+
+	return reflect.ValueOf(v), nil
+}
+
+func TestRegister(t *testing.T) {
+	param.Register(reflect.TypeOf(registeredVersion{}), param.Parser{
+		Parse:        parseRegisteredVersion,
+		ValueName:    "version",
+		Autocomplete: func() []string { return []string{"v1.0", "v2.0"} },
+	})
+
+	var v registeredVersion
+	p, err := param.New(&v)
+	assert.NoError(t, err)
+	assert.NoError(t, p.UnmarshalText([]byte("v1.2")))
+	assert.Equal(t, registeredVersion{Major: 1, Minor: 2}, v)
+	assert.EqualError(t, p.UnmarshalText([]byte("1.2")), "invalid version: 1.2")
+
+	var s []registeredVersion
+	p, err = param.New(&s)
+	assert.NoError(t, err)
+	assert.NoError(t, p.UnmarshalText([]byte("v1.2")))
+	assert.NoError(t, p.UnmarshalText([]byte("v3.4")))
+	assert.Equal(t, []registeredVersion{{Major: 1, Minor: 2}, {Major: 3, Minor: 4}}, s)
+
+	var ptr *registeredVersion
+	p, err = param.New(&ptr)
+	assert.NoError(t, err)
+	assert.NoError(t, p.UnmarshalText([]byte("v1.2")))
+	assert.Equal(t, &registeredVersion{Major: 1, Minor: 2}, ptr)
+
+	var m map[string]registeredVersion
+	p, err = param.New(&m)
+	assert.NoError(t, err)
+	assert.NoError(t, p.UnmarshalText([]byte("foo=v1.2")))
+	assert.Equal(t, map[string]registeredVersion{"foo": {Major: 1, Minor: 2}}, m)
+
+	assert.Equal(t, "version", param.ValueName(reflect.TypeOf(v)))
+	assert.Equal(t, "version", param.ValueName(reflect.TypeOf(s)))
+	assert.Equal(t, "key=value", param.ValueName(reflect.TypeOf(m)))
+
+	values, ok := param.Autocomplete(reflect.TypeOf(s))
+	assert.True(t, ok)
+	assert.Equal(t, []string{"v1.0", "v2.0"}, values)
+
+	_, ok = param.Autocomplete(reflect.TypeOf(m))
+	assert.False(t, ok)
+}
+
+type registeredUnmarshaler struct {
+	s string
+}
+
+func (r *registeredUnmarshaler) UnmarshalText(_ []byte) error {
+	return fmt.Errorf("not registered")
+}
+
+func TestRegisterOverridesTextUnmarshaler(t *testing.T) {
+	param.Register(reflect.TypeOf(registeredUnmarshaler{}), param.Parser{
+		Parse: func(s string) (reflect.Value, error) {
+			return reflect.ValueOf(registeredUnmarshaler{s: s}), nil
+		},
+	})
+
+	var v registeredUnmarshaler
+	p, err := param.New(&v)
+	assert.NoError(t, err)
+	assert.NoError(t, p.UnmarshalText([]byte("foo")))
+	assert.Equal(t, registeredUnmarshaler{s: "foo"}, v)
+}
+
+type listValue []string
+
+func (l *listValue) String() string { return fmt.Sprint(*l) }
+
+func (l *listValue) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+type boolValue bool
+
+func (b *boolValue) String() string { return fmt.Sprint(*b) }
+
+func (b *boolValue) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	*b = boolValue(v)
+	return err
+}
+
+func (b *boolValue) IsBoolFlag() bool { return true }
+
+func TestNewFlagValue(t *testing.T) {
+	var v listValue
+	p, err := param.New(&v)
+	assert.NoError(t, err)
+	assert.True(t, param.MustTakeValue(p))
+
+	assert.NoError(t, p.UnmarshalText([]byte("foo")))
+	assert.NoError(t, p.UnmarshalText([]byte("bar")))
+	assert.Equal(t, listValue{"foo", "bar"}, v)
+}
+
+func TestNewFlagGetter(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("n", 0, "")
+
+	v := fs.Lookup("n").Value
+	p, err := param.New(v)
+	assert.NoError(t, err)
+
+	assert.NoError(t, p.UnmarshalText([]byte("3")))
+	assert.Equal(t, 3, v.(flag.Getter).Get())
+	assert.Error(t, p.UnmarshalText([]byte("foo")))
+}
+
+func TestNewBoolFlagValue(t *testing.T) {
+	var v boolValue
+	p, err := param.New(&v)
+	assert.NoError(t, err)
+	assert.True(t, param.IsBool(p))
+	assert.False(t, param.MayTakeValue(p))
+
+	assert.NoError(t, p.UnmarshalText([]byte("")))
+	assert.Equal(t, boolValue(true), v)
+
+	assert.NoError(t, p.UnmarshalText([]byte("false")))
+	assert.Equal(t, boolValue(false), v)
+}
+
+type jsonFilter struct {
+	Status string `json:"status"`
+	Limit  int    `json:"limit"`
+}
+
+type jsonPatch struct {
+	Ops []string
+}
+
+func (p *jsonPatch) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &p.Ops)
+}
+
+func TestNewJSON(t *testing.T) {
+	var v jsonFilter
+	p, err := param.NewWithOptions(&v, param.Options{Format: param.FormatJSON})
+	assert.NoError(t, err)
+
+	assert.NoError(t, p.UnmarshalText([]byte(`{"status":"open","limit":3}`)))
+	assert.Equal(t, jsonFilter{Status: "open", Limit: 3}, v)
+
+	// Giving a value again replaces, rather than merges into, the old one.
+	assert.NoError(t, p.UnmarshalText([]byte(`{"limit":5}`)))
+	assert.Equal(t, jsonFilter{Limit: 5}, v)
+
+	assert.EqualError(t, p.UnmarshalText([]byte(`{"limit":"5"}`)),
+		"invalid JSON: json: cannot unmarshal string into Go struct field jsonFilter.limit of type int")
+	assert.EqualError(t, p.UnmarshalText([]byte(`status=open`)),
+		"invalid JSON: invalid character 's' looking for beginning of value")
+}
+
+func TestNewJSONMap(t *testing.T) {
+	var v map[string]int
+	p, err := param.NewWithOptions(&v, param.Options{Format: param.FormatJSON})
+	assert.NoError(t, err)
+
+	assert.NoError(t, p.UnmarshalText([]byte(`{"a":1,"b":2}`)))
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, v)
+}
+
+func TestNewJSONSlice(t *testing.T) {
+	var v []jsonFilter
+	p, err := param.NewWithOptions(&v, param.Options{Format: param.FormatJSON})
+	assert.NoError(t, err)
+
+	assert.NoError(t, p.UnmarshalText([]byte(`{"status":"open"}`)))
+	assert.NoError(t, p.UnmarshalText([]byte(`{"status":"closed"}`)))
+	assert.Equal(t, []jsonFilter{{Status: "open"}, {Status: "closed"}}, v)
+}
+
+func TestNewJSONUnmarshaler(t *testing.T) {
+	var v jsonPatch
+	p, err := param.New(&v)
+	assert.NoError(t, err)
+
+	assert.NoError(t, p.UnmarshalText([]byte(`["add","remove"]`)))
+	assert.Equal(t, jsonPatch{Ops: []string{"add", "remove"}}, v)
+}
+
+func TestNewJSONFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "patch.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`["add"]`), 0644))
+
+	var v jsonPatch
+	p, err := param.New(&v)
+	assert.NoError(t, err)
+
+	assert.NoError(t, p.UnmarshalText([]byte("@"+path)))
+	assert.Equal(t, jsonPatch{Ops: []string{"add"}}, v)
+
+	assert.Error(t, p.UnmarshalText([]byte("@"+path+".missing")))
+}
+
+func TestNewUnsupportedFormat(t *testing.T) {
+	var v jsonFilter
+	_, err := param.NewWithOptions(&v, param.Options{Format: "yaml"})
+	assert.EqualError(t, err, "unsupported format: yaml")
+}
+
+func TestValueNameJSON(t *testing.T) {
+	json := param.Options{Format: param.FormatJSON}
+	assert.Equal(t, "json", param.ValueNameWithOptions(reflect.TypeOf(jsonFilter{}), json))
+	assert.Equal(t, "json", param.ValueNameWithOptions(reflect.TypeOf([]jsonFilter{}), json))
+	assert.Equal(t, "json", param.ValueNameWithOptions(reflect.TypeOf(map[string]int{}), json))
+	assert.Equal(t, "json", param.ValueName(reflect.TypeOf(jsonPatch{})))
+	assert.Equal(t, "json", param.ValueName(reflect.TypeOf(&jsonPatch{})))
+	assert.Equal(t, "time", param.ValueName(reflect.TypeOf(time.Time{})))
+}
+
 func TestNewInt(t *testing.T) {
 	var v int
 	p, err := param.New(&v)
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -24,18 +25,62 @@ type ParsedTag struct {
 	PosArgName    string
 	IsTrailing    bool
 	Usage         string
+	EnvVar        string
+	Default       string
+	Required      bool
+	Enum          []string
+	Exclusive     []string
+	AnyOf         []string
+	Requires      []string
+	Negatable     bool
+	Persistent    bool
+	Counter       bool
+	UniqueKeys    bool
+	Separator     string
+	Layout        string
+	DefaultPort   uint16
+	Schemes       []string
+	Format        string
+	MinArgs       int
+	MaxArgs       int
+	Aliases       []string
+	HideAliases   bool
 }
 
 const (
-	tagCLI   = "cli"
-	tagValue = "value"
-	tagUsage = "usage"
+	tagCLI         = "cli"
+	tagValue       = "value"
+	tagUsage       = "usage"
+	tagEnv         = "env"
+	tagDefault     = "default"
+	tagRequired    = "required"
+	tagEnum        = "enum"
+	tagExclusive   = "exclusive"
+	tagAnyOf       = "anyof"
+	tagRequires    = "requires"
+	tagNegatable   = "negatable"
+	tagPersistent  = "persistent"
+	tagCounter     = "counter"
+	tagUniqueKeys  = "uniquekeys"
+	tagSeparator   = "sep"
+	tagLayout      = "layout"
+	tagDefaultPort = "defaultport"
+	tagSchemes     = "schemes"
+	tagFormat      = "format"
+	tagMinArgs     = "minargs"
+	tagMaxArgs     = "maxargs"
+	tagAliases     = "aliases"
+	tagHideAliases = "hidealiases"
 
 	cliSubcmd = "subcmd"
+
+	formatJSON = "json"
 )
 
 var paramRegex = regexp.MustCompile("^[a-zA-Z][a-zA-Z0-9_-]*$")
 
+var envRegex = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
 func Parse(tag reflect.StructTag) (ParsedTag, error) {
 	cli, ok := tag.Lookup(tagCLI)
 	if !ok {
@@ -106,6 +151,235 @@ func Parse(tag reflect.StructTag) (ParsedTag, error) {
 		parsed = ParsedTag{Kind: KindPosArg, PosArgName: cliParts[0]}
 	}
 
+	if env, ok := tag.Lookup(tagEnv); ok {
+		if parsed.Kind != KindFlag {
+			return ParsedTag{}, fmt.Errorf("env tag can only be used on options: %v", cli)
+		}
+
+		if !envRegex.MatchString(env) {
+			return ParsedTag{}, fmt.Errorf("invalid environment variable name: %v", env)
+		}
+
+		parsed.EnvVar = env
+	}
+
+	if def, ok := tag.Lookup(tagDefault); ok {
+		if parsed.Kind != KindFlag {
+			return ParsedTag{}, fmt.Errorf("default tag can only be used on options: %v", cli)
+		}
+
+		parsed.Default = def
+	}
+
+	if required, ok := tag.Lookup(tagRequired); ok {
+		if parsed.Kind != KindFlag {
+			return ParsedTag{}, fmt.Errorf("required tag can only be used on options: %v", cli)
+		}
+
+		v, err := strconv.ParseBool(required)
+		if err != nil {
+			return ParsedTag{}, fmt.Errorf("invalid required tag: %v", required)
+		}
+
+		parsed.Required = v
+	}
+
+	if enum, ok := tag.Lookup(tagEnum); ok {
+		if parsed.Kind == KindSubcmd {
+			return ParsedTag{}, fmt.Errorf("enum tag cannot be used on subcommands: %v", cli)
+		}
+
+		parsed.Enum = strings.Split(enum, ",")
+	}
+
+	if exclusive, ok := tag.Lookup(tagExclusive); ok {
+		if parsed.Kind != KindFlag {
+			return ParsedTag{}, fmt.Errorf("exclusive tag can only be used on options: %v", cli)
+		}
+
+		parsed.Exclusive = strings.Split(exclusive, ",")
+	}
+
+	if anyOf, ok := tag.Lookup(tagAnyOf); ok {
+		if parsed.Kind != KindFlag {
+			return ParsedTag{}, fmt.Errorf("anyof tag can only be used on options: %v", cli)
+		}
+
+		parsed.AnyOf = strings.Split(anyOf, ",")
+	}
+
+	if requires, ok := tag.Lookup(tagRequires); ok {
+		if parsed.Kind != KindFlag {
+			return ParsedTag{}, fmt.Errorf("requires tag can only be used on options: %v", cli)
+		}
+
+		for _, part := range strings.Split(requires, ",") {
+			if !strings.HasPrefix(part, "-") {
+				return ParsedTag{}, fmt.Errorf("invalid flag name in requires tag: %v", part)
+			}
+
+			parsed.Requires = append(parsed.Requires, part)
+		}
+	}
+
+	if negatable, ok := tag.Lookup(tagNegatable); ok {
+		if parsed.Kind != KindFlag || parsed.LongFlagName == "" {
+			return ParsedTag{}, fmt.Errorf("negatable tag can only be used on long options: %v", cli)
+		}
+
+		v, err := strconv.ParseBool(negatable)
+		if err != nil {
+			return ParsedTag{}, fmt.Errorf("invalid negatable tag: %v", negatable)
+		}
+
+		parsed.Negatable = v
+	}
+
+	if persistent, ok := tag.Lookup(tagPersistent); ok {
+		if parsed.Kind != KindFlag {
+			return ParsedTag{}, fmt.Errorf("persistent tag can only be used on options: %v", cli)
+		}
+
+		v, err := strconv.ParseBool(persistent)
+		if err != nil {
+			return ParsedTag{}, fmt.Errorf("invalid persistent tag: %v", persistent)
+		}
+
+		parsed.Persistent = v
+	}
+
+	if counter, ok := tag.Lookup(tagCounter); ok {
+		if parsed.Kind != KindFlag {
+			return ParsedTag{}, fmt.Errorf("counter tag can only be used on options: %v", cli)
+		}
+
+		v, err := strconv.ParseBool(counter)
+		if err != nil {
+			return ParsedTag{}, fmt.Errorf("invalid counter tag: %v", counter)
+		}
+
+		parsed.Counter = v
+	}
+
+	if uniqueKeys, ok := tag.Lookup(tagUniqueKeys); ok {
+		if parsed.Kind != KindFlag {
+			return ParsedTag{}, fmt.Errorf("uniquekeys tag can only be used on options: %v", cli)
+		}
+
+		v, err := strconv.ParseBool(uniqueKeys)
+		if err != nil {
+			return ParsedTag{}, fmt.Errorf("invalid uniquekeys tag: %v", uniqueKeys)
+		}
+
+		parsed.UniqueKeys = v
+	}
+
+	if sep, ok := tag.Lookup(tagSeparator); ok {
+		if parsed.Kind != KindFlag {
+			return ParsedTag{}, fmt.Errorf("sep tag can only be used on options: %v", cli)
+		}
+
+		if sep == "" || strings.Contains(sep, "\\") {
+			return ParsedTag{}, fmt.Errorf("invalid sep tag: %q", sep)
+		}
+
+		parsed.Separator = sep
+	}
+
+	if layout, ok := tag.Lookup(tagLayout); ok {
+		if parsed.Kind == KindSubcmd {
+			return ParsedTag{}, fmt.Errorf("layout tag cannot be used on subcommands: %v", cli)
+		}
+
+		parsed.Layout = layout
+	}
+
+	if defaultPort, ok := tag.Lookup(tagDefaultPort); ok {
+		if parsed.Kind == KindSubcmd {
+			return ParsedTag{}, fmt.Errorf("defaultport tag cannot be used on subcommands: %v", cli)
+		}
+
+		v, err := strconv.ParseUint(defaultPort, 10, 16)
+		if err != nil || v == 0 {
+			return ParsedTag{}, fmt.Errorf("invalid defaultport tag: %v", defaultPort)
+		}
+
+		parsed.DefaultPort = uint16(v)
+	}
+
+	if schemes, ok := tag.Lookup(tagSchemes); ok {
+		if parsed.Kind == KindSubcmd {
+			return ParsedTag{}, fmt.Errorf("schemes tag cannot be used on subcommands: %v", cli)
+		}
+
+		parsed.Schemes = strings.Split(schemes, ",")
+	}
+
+	if format, ok := tag.Lookup(tagFormat); ok {
+		if parsed.Kind == KindSubcmd {
+			return ParsedTag{}, fmt.Errorf("format tag cannot be used on subcommands: %v", cli)
+		}
+
+		if format != formatJSON {
+			return ParsedTag{}, fmt.Errorf("invalid format tag: %v", format)
+		}
+
+		parsed.Format = format
+	}
+
+	if minArgs, ok := tag.Lookup(tagMinArgs); ok {
+		if !parsed.IsTrailing {
+			return ParsedTag{}, fmt.Errorf("minargs tag can only be used on trailing arguments: %v", cli)
+		}
+
+		v, err := strconv.ParseUint(minArgs, 10, 0)
+		if err != nil {
+			return ParsedTag{}, fmt.Errorf("invalid minargs tag: %v", minArgs)
+		}
+
+		parsed.MinArgs = int(v)
+	}
+
+	if maxArgs, ok := tag.Lookup(tagMaxArgs); ok {
+		if !parsed.IsTrailing {
+			return ParsedTag{}, fmt.Errorf("maxargs tag can only be used on trailing arguments: %v", cli)
+		}
+
+		v, err := strconv.ParseUint(maxArgs, 10, 0)
+		if err != nil || v == 0 || int(v) < parsed.MinArgs {
+			return ParsedTag{}, fmt.Errorf("invalid maxargs tag: %v", maxArgs)
+		}
+
+		parsed.MaxArgs = int(v)
+	}
+
+	if aliases, ok := tag.Lookup(tagAliases); ok {
+		if parsed.Kind != KindSubcmd {
+			return ParsedTag{}, fmt.Errorf("aliases tag can only be used on subcommands: %v", cli)
+		}
+
+		for _, alias := range strings.Split(aliases, ",") {
+			if !paramRegex.MatchString(alias) {
+				return ParsedTag{}, fmt.Errorf("invalid subcommand alias: %v", alias)
+			}
+
+			parsed.Aliases = append(parsed.Aliases, alias)
+		}
+	}
+
+	if hideAliases, ok := tag.Lookup(tagHideAliases); ok {
+		if parsed.Kind != KindSubcmd {
+			return ParsedTag{}, fmt.Errorf("hidealiases tag can only be used on subcommands: %v", cli)
+		}
+
+		v, err := strconv.ParseBool(hideAliases)
+		if err != nil {
+			return ParsedTag{}, fmt.Errorf("invalid hidealiases tag: %v", hideAliases)
+		}
+
+		parsed.HideAliases = v
+	}
+
 	parsed.FlagValueName = tag.Get(tagValue)
 	parsed.Usage = tag.Get(tagUsage)
 	return parsed, nil
@@ -86,6 +86,226 @@ func TestParse(t *testing.T) {
 			In:  `cli:"foo~..."`,
 			Err: "invalid positional argument name: foo~...",
 		},
+		{
+			In:  `cli:"--foo" env:"FOO_BAR"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindFlag, LongFlagName: "foo", EnvVar: "FOO_BAR"},
+		},
+		{
+			In:  `cli:"--foo" env:"FOO-BAR"`,
+			Err: "invalid environment variable name: FOO-BAR",
+		},
+		{
+			In:  `cli:"foo" env:"FOO"`,
+			Err: "env tag can only be used on options: foo",
+		},
+		{
+			In:  `cli:"--foo" default:"30s"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindFlag, LongFlagName: "foo", Default: "30s"},
+		},
+		{
+			In:  `cli:"foo" default:"30s"`,
+			Err: "default tag can only be used on options: foo",
+		},
+		{
+			In:  `cli:"--foo" required:"true"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindFlag, LongFlagName: "foo", Required: true},
+		},
+		{
+			In:  `cli:"--foo" required:"xxx"`,
+			Err: "invalid required tag: xxx",
+		},
+		{
+			In:  `cli:"foo" required:"true"`,
+			Err: "required tag can only be used on options: foo",
+		},
+		{
+			In:  `cli:"--foo" enum:"a,b,c"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindFlag, LongFlagName: "foo", Enum: []string{"a", "b", "c"}},
+		},
+		{
+			In:  `cli:"foo" enum:"a,b,c"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindPosArg, PosArgName: "foo", Enum: []string{"a", "b", "c"}},
+		},
+		{
+			In:  `cli:"foo,subcmd" enum:"a,b,c"`,
+			Err: "enum tag cannot be used on subcommands: foo,subcmd",
+		},
+		{
+			In:  `cli:"--foo" exclusive:"a,b"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindFlag, LongFlagName: "foo", Exclusive: []string{"a", "b"}},
+		},
+		{
+			In:  `cli:"foo" exclusive:"a"`,
+			Err: "exclusive tag can only be used on options: foo",
+		},
+		{
+			In:  `cli:"--foo" anyof:"a"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindFlag, LongFlagName: "foo", AnyOf: []string{"a"}},
+		},
+		{
+			In:  `cli:"foo" anyof:"a"`,
+			Err: "anyof tag can only be used on options: foo",
+		},
+		{
+			In:  `cli:"--foo" requires:"--bar,-b"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindFlag, LongFlagName: "foo", Requires: []string{"--bar", "-b"}},
+		},
+		{
+			In:  `cli:"--foo" requires:"bar"`,
+			Err: "invalid flag name in requires tag: bar",
+		},
+		{
+			In:  `cli:"foo" requires:"--bar"`,
+			Err: "requires tag can only be used on options: foo",
+		},
+		{
+			In:  `cli:"--foo" negatable:"true"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindFlag, LongFlagName: "foo", Negatable: true},
+		},
+		{
+			In:  `cli:"--foo" negatable:"xxx"`,
+			Err: "invalid negatable tag: xxx",
+		},
+		{
+			In:  `cli:"-f" negatable:"true"`,
+			Err: "negatable tag can only be used on long options: -f",
+		},
+		{
+			In:  `cli:"-v" counter:"true"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindFlag, ShortFlagName: "v", Counter: true},
+		},
+		{
+			In:  `cli:"-v" counter:"xxx"`,
+			Err: "invalid counter tag: xxx",
+		},
+		{
+			In:  `cli:"v" counter:"true"`,
+			Err: "counter tag can only be used on options: v",
+		},
+		{
+			In:  `cli:"--label" uniquekeys:"true"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindFlag, LongFlagName: "label", UniqueKeys: true},
+		},
+		{
+			In:  `cli:"--label" uniquekeys:"xxx"`,
+			Err: "invalid uniquekeys tag: xxx",
+		},
+		{
+			In:  `cli:"label" uniquekeys:"true"`,
+			Err: "uniquekeys tag can only be used on options: label",
+		},
+		{
+			In:  `cli:"--tags" sep:","`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindFlag, LongFlagName: "tags", Separator: ","},
+		},
+		{
+			In:  `cli:"--tags" sep:""`,
+			Err: "invalid sep tag: \"\"",
+		},
+		{
+			In:  `cli:"tags" sep:","`,
+			Err: "sep tag can only be used on options: tags",
+		},
+		{
+			In:  `cli:"--since" layout:"2006-01-02"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindFlag, LongFlagName: "since", Layout: "2006-01-02"},
+		},
+		{
+			In:  `cli:"since" layout:"2006-01-02"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindPosArg, PosArgName: "since", Layout: "2006-01-02"},
+		},
+		{
+			In:  `cli:"since,subcmd" layout:"2006-01-02"`,
+			Err: "layout tag cannot be used on subcommands: since,subcmd",
+		},
+		{
+			In:  `cli:"--addr" defaultport:"443"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindFlag, LongFlagName: "addr", DefaultPort: 443},
+		},
+		{
+			In:  `cli:"--addr" defaultport:"https"`,
+			Err: "invalid defaultport tag: https",
+		},
+		{
+			In:  `cli:"--addr" defaultport:"0"`,
+			Err: "invalid defaultport tag: 0",
+		},
+		{
+			In:  `cli:"--endpoint" schemes:"http,https"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindFlag, LongFlagName: "endpoint", Schemes: []string{"http", "https"}},
+		},
+		{
+			In:  `cli:"endpoint,subcmd" schemes:"http"`,
+			Err: "schemes tag cannot be used on subcommands: endpoint,subcmd",
+		},
+		{
+			In:  `cli:"--filter" format:"json"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindFlag, LongFlagName: "filter", Format: "json"},
+		},
+		{
+			In:  `cli:"--filter" format:"yaml"`,
+			Err: "invalid format tag: yaml",
+		},
+		{
+			In:  `cli:"filter,subcmd" format:"json"`,
+			Err: "format tag cannot be used on subcommands: filter,subcmd",
+		},
+		{
+			In:  `cli:"pids..." minargs:"1" maxargs:"3"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindPosArg, PosArgName: "pids", IsTrailing: true, MinArgs: 1, MaxArgs: 3},
+		},
+		{
+			In:  `cli:"pid" minargs:"1"`,
+			Err: "minargs tag can only be used on trailing arguments: pid",
+		},
+		{
+			In:  `cli:"--pid" maxargs:"1"`,
+			Err: "maxargs tag can only be used on trailing arguments: --pid",
+		},
+		{
+			In:  `cli:"pids..." minargs:"-1"`,
+			Err: "invalid minargs tag: -1",
+		},
+		{
+			In:  `cli:"pids..." minargs:"2" maxargs:"1"`,
+			Err: "invalid maxargs tag: 1",
+		},
+		{
+			In:  `cli:"-v,--verbose" persistent:"true"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindFlag, ShortFlagName: "v", LongFlagName: "verbose", Persistent: true},
+		},
+		{
+			In:  `cli:"verbose" persistent:"true"`,
+			Err: "persistent tag can only be used on options: verbose",
+		},
+		{
+			In:  `cli:"--verbose" persistent:"xxx"`,
+			Err: "invalid persistent tag: xxx",
+		},
+		{
+			In:  `cli:"remove,subcmd" aliases:"rm,del"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindSubcmd, CommandName: "remove", Aliases: []string{"rm", "del"}},
+		},
+		{
+			In:  `cli:"remove,subcmd" aliases:"rm" hidealiases:"true"`,
+			Out: tagparse.ParsedTag{Kind: tagparse.KindSubcmd, CommandName: "remove", Aliases: []string{"rm"}, HideAliases: true},
+		},
+		{
+			In:  `cli:"remove,subcmd" aliases:"rm,-d"`,
+			Err: "invalid subcommand alias: -d",
+		},
+		{
+			In:  `cli:"--remove" aliases:"rm"`,
+			Err: "aliases tag can only be used on subcommands: --remove",
+		},
+		{
+			In:  `cli:"--remove" hidealiases:"true"`,
+			Err: "hidealiases tag can only be used on subcommands: --remove",
+		},
+		{
+			In:  `cli:"remove,subcmd" hidealiases:"xxx"`,
+			Err: "invalid hidealiases tag: xxx",
+		},
 	}
 
 	for _, tt := range testCases {